@@ -2,6 +2,7 @@ package see
 
 import (
 	"net/http"
+	"strconv"
 	"testing"
 )
 
@@ -104,6 +105,42 @@ func Benchmark404Many(B *testing.B) {
 	runRequest(B, router, "GET", "/viewfake")
 }
 
+func BenchmarkManyGroups(B *testing.B) {
+	router := New()
+	router.Use(func(c *Context) {})
+	for i := 0; i < 60; i++ {
+		group := router.Group("/group" + strconv.Itoa(i))
+		group.Use(func(c *Context) {})
+		group.GET("/ping", func(c *Context) {})
+		group.GET("/user/:id", func(c *Context) {})
+	}
+	runRequest(B, router, "GET", "/group59/ping")
+}
+
+func BenchmarkManyGroupsParam(B *testing.B) {
+	router := New()
+	router.Use(func(c *Context) {})
+	for i := 0; i < 60; i++ {
+		group := router.Group("/group" + strconv.Itoa(i))
+		group.Use(func(c *Context) {})
+		group.GET("/ping", func(c *Context) {})
+		group.GET("/user/:id", func(c *Context) {})
+	}
+	runRequest(B, router, "GET", "/group30/user/12345")
+}
+
+func BenchmarkManyGroups404(B *testing.B) {
+	router := New()
+	router.Use(func(c *Context) {})
+	for i := 0; i < 60; i++ {
+		group := router.Group("/group" + strconv.Itoa(i))
+		group.Use(func(c *Context) {})
+		group.GET("/ping", func(c *Context) {})
+	}
+	router.NoRoute(func(c *Context) {})
+	runRequest(B, router, "GET", "/group59/pong")
+}
+
 type mockWriter struct {
 	headers http.Header
 }
@@ -0,0 +1,80 @@
+package see
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// 路由参数约束，如 /user/:id<int>、/file/:name<[a-z]+\.txt>，
+// 参数值不满足约束时当作该路由没有匹配
+type constraint struct {
+	expr  string
+	match func(value string) bool
+}
+
+// 内置的约束类型，其他的约束按正则表达式处理，正则需要匹配整个参数值
+var constraintTypes = map[string]func(value string) bool{
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"uint": func(value string) bool {
+		_, err := strconv.ParseUint(value, 10, 64)
+		return err == nil
+	},
+	"float": func(value string) bool {
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	},
+	"bool": func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	},
+	"alpha": func(value string) bool {
+		for i := 0; i < len(value); i++ {
+			if c := value[i] | 0x20; c < 'a' || c > 'z' {
+				return false
+			}
+		}
+		return true
+	},
+	"alnum": func(value string) bool {
+		for i := 0; i < len(value); i++ {
+			if c := value[i]; !isDigit(c) && (c|0x20 < 'a' || c|0x20 > 'z') {
+				return false
+			}
+		}
+		return true
+	},
+	"uuid": func(value string) bool {
+		if len(value) != 36 {
+			return false
+		}
+		for i := 0; i < len(value); i++ {
+			c := value[i]
+			if i == 8 || i == 13 || i == 18 || i == 23 {
+				if c != '-' {
+					return false
+				}
+			} else if !isDigit(c) && (c|0x20 < 'a' || c|0x20 > 'f') {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func newConstraint(expr string) (*constraint, error) {
+	if match, ok := constraintTypes[expr]; ok {
+		return &constraint{expr: expr, match: match}, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &constraint{expr: expr, match: re.MatchString}, nil
+}
@@ -11,11 +11,14 @@ import (
 	"github.com/junbin-yang/see/verify"
 	"gopkg.in/yaml.v2"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tidwall/sjson"
@@ -58,7 +61,9 @@ type Context struct {
 	// 路由参数
 	Params Params
 
-	// 响应信息
+	// 响应的状态码，没有设置过时为0
+	//
+	// Deprecated: 使用 c.Writer.Status()，直接修改该字段不会改变响应的状态码
 	StatusCode int
 
 	// 中间件
@@ -70,15 +75,21 @@ type Context struct {
 	// 处理过程中设置在上下文中的数据
 	Keys Keys
 
-	Req    *http.Request
-	Writer http.ResponseWriter
-	engine *Engine
-	index  int
+	// 处理过程中记录的错误，见c.Error
+	Errors errorMsgs
+
+	Req       *http.Request
+	Writer    ResponseWriter
+	writermem responseWriter
+	engine    *Engine
+	index     int
 }
 
 // 初始化上下文实例
 func (c *Context) SetContext(w http.ResponseWriter, r *http.Request) {
-	c.Writer = w
+	c.writermem.reset(w)
+	c.writermem.statusCode = &c.StatusCode
+	c.Writer = &c.writermem
 	c.Req = r
 	c.Path = r.URL.Path
 	c.Method = r.Method
@@ -93,6 +104,7 @@ func (c *Context) Reset() {
 	c.StatusCode = 0
 	c.Params = c.Params[:0]
 	c.Keys = c.Keys[:0]
+	c.Errors = c.Errors[:0]
 }
 
 func (c *Context) CopyRawData() ([]byte, error) {
@@ -121,6 +133,28 @@ func (c *Context) Param(key string) string {
 	return c.Params.ByName(key)
 }
 
+// 获取转换为具体类型的动态参数，参数不存在或转换失败时返回错误，
+// 配合参数约束使用，如 /user/:id<int>
+func (c *Context) ParamInt(key string) (int, error) {
+	return strconv.Atoi(c.Param(key))
+}
+
+func (c *Context) ParamInt64(key string) (int64, error) {
+	return strconv.ParseInt(c.Param(key), 10, 64)
+}
+
+func (c *Context) ParamUint64(key string) (uint64, error) {
+	return strconv.ParseUint(c.Param(key), 10, 64)
+}
+
+func (c *Context) ParamFloat64(key string) (float64, error) {
+	return strconv.ParseFloat(c.Param(key), 64)
+}
+
+func (c *Context) ParamBool(key string) (bool, error) {
+	return strconv.ParseBool(c.Param(key))
+}
+
 // 获取Url上的参数,?x=y
 func (c *Context) Query(name string) string {
 	value, _ := c.GetQuery(name)
@@ -154,16 +188,118 @@ func (c *Context) GetQuery(key string) (string, bool) {
 	return "", false
 }
 
-// 返回磁盘上某个文件
+// 返回磁盘上某个文件，文件内容直接从磁盘读取，Range、If-Range和If-Modified-Since
+// 等条件请求由http.ServeContent处理
 func (c *Context) File(filepath string) {
-	file, err := os.ReadFile(filepath)
-	if err != nil || file == nil {
-		c.StatusCode = http.StatusNotFound
+	c.serveFile(filepath, "")
+}
+
+// 以附件形式返回文件，浏览器会下载并保存为filename，filename为空时使用原文件名。
+// 文件名按RFC 6266设置，包含非ASCII字符时同时提供UTF-8编码的filename*
+func (c *Context) FileAttachment(filepath, filename string) {
+	if filename == "" {
+		filename = path.Base(strings.ReplaceAll(filepath, "\\", "/"))
+	}
+	c.serveFile(filepath, contentDisposition("attachment", filename))
+}
+
+func (c *Context) serveFile(filepath, disposition string) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		http.Error(c.Writer, "File Not Found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		http.Error(c.Writer, "File Not Found", http.StatusNotFound)
+		return
+	}
+	if disposition != "" {
+		c.Writer.Header().Set("Content-Disposition", disposition)
+	}
+	http.ServeContent(c.Writer, c.Req, stat.Name(), stat.ModTime(), file)
+}
+
+// 生成Content-Disposition，filename为ASCII的替代名称，非ASCII字符替换为 _
+func contentDisposition(disposition, filename string) string {
+	var ascii, encoded strings.Builder
+	needEncode := false
+	for i := 0; i < len(filename); i++ {
+		b := filename[i]
+		switch {
+		case b >= 0x80 || b < 0x20 || b == 0x7f:
+			needEncode = true
+			if b < 0x80 || b >= 0xc0 {
+				ascii.WriteByte('_')
+			}
+		case b == '"' || b == '\\':
+			ascii.WriteByte('\\')
+			ascii.WriteByte(b)
+		default:
+			ascii.WriteByte(b)
+		}
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	value := disposition + `; filename="` + ascii.String() + `"`
+	if needEncode {
+		value += "; filename*=UTF-8''" + encoded.String()
+	}
+	return value
+}
+
+// RFC 5987中不需要编码的字符
+func isAttrChar(b byte) bool {
+	if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+// 返回fs.FS中的文件，如embed.FS，filepath为目录时返回其中的index.html
+func (c *Context) FileFromFS(filepath string, fsys fs.FS) {
+	name := strings.TrimPrefix(path.Clean("/"+filepath), "/")
+	if name == "" {
+		name = "."
+	}
+	file, stat, err := openFile(fsys, name)
+	if err == nil && stat.IsDir() {
+		file.Close()
+		file, stat, err = openFile(fsys, path.Join(name, "index.html"))
+	}
+	if err != nil {
 		http.Error(c.Writer, "File Not Found", http.StatusNotFound)
 		return
 	}
-	c.StatusCode = http.StatusOK
-	http.ServeFile(c.Writer, c.Req, filepath)
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(c.Writer, c.Req, stat.Name(), stat.ModTime(), content)
+}
+
+func openFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, stat, nil
 }
 
 // 获取表单参数
@@ -219,12 +355,11 @@ func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error
 
 // 设置状态码
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
 }
 
 // 设置头信息
-// 注意在 WriteHeader() 后调用 Header().Set 是不会生效的
+// 注意在写出响应头后调用 Header().Set 是不会生效的
 func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
 }
@@ -243,11 +378,13 @@ func (c *Context) YAML(code int, obj interface{}) {
 	c.Status(code)
 	bytes, err := yaml.Marshal(obj)
 	if err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
 	_, err = c.Writer.Write(bytes)
 	if err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
@@ -259,6 +396,7 @@ func (c *Context) XML(code int, obj interface{}) {
 	c.Status(code)
 	encoder := xml.NewEncoder(c.Writer)
 	if err := encoder.Encode(obj); err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
@@ -270,6 +408,7 @@ func (c *Context) JSON(code int, obj interface{}) {
 	c.Status(code)
 	encoder := json.NewEncoder(c.Writer)
 	if err := encoder.Encode(obj); err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
@@ -282,6 +421,7 @@ func (c *Context) PureJSON(code int, obj interface{}) {
 	encoder := json.NewEncoder(c.Writer)
 	encoder.SetEscapeHTML(false)
 	if err := encoder.Encode(obj); err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
@@ -293,6 +433,7 @@ func (c *Context) AsciiJSON(code int, obj interface{}) {
 	c.Status(code)
 	jstr, err := json.Marshal(obj)
 	if err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 		return
 	}
@@ -336,7 +477,6 @@ func (c *Context) Redirect(code int, location string) {
 	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
 		panic(fmt.Sprintf("Cannot be redirected using status code %d", code))
 	}
-	c.StatusCode = code
 	http.Redirect(c.Writer, c.Req, location, code)
 }
 
@@ -347,6 +487,9 @@ func (c *Context) HTML(code int, html string) {
 	_, _ = c.Writer.Write(bytesconv.StringToBytes(html))
 }
 
+// 中断后的下标，大于任何中间件链的长度
+const abortIndex = math.MaxInt32 / 2
+
 // 执行下一个函数
 func (c *Context) Next() {
 	c.index++
@@ -356,21 +499,74 @@ func (c *Context) Next() {
 			c.handlers[c.index](c)
 		}
 	}
+	// 中断后index不会等于s，不再执行路由的处理函数
 	if c.index == s && c.lastHandler != nil {
 		c.lastHandler(c)
 	}
 }
 
-// 中间件的中断开关
+// 中间件的中断开关，之后的中间件和路由的处理函数都不再执行，
+// 已经在执行的中间件会继续执行完
 func (c *Context) Abort() {
-	// 直接让计数下角标等于中间件数组长度
-	c.index = len(c.handlers)
+	c.index = abortIndex
+}
+
+// 是否已经中断
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// 设置状态码，立即写出响应头并中断
+//
+//	if !authorized(c) {
+//		c.AbortWithStatus(http.StatusUnauthorized)
+//		return
+//	}
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
+
+// 中断并返回JSON
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.JSON(code, obj)
+}
+
+// 设置状态码，中断并记录错误。响应头不会立即写出，Engine.ErrorHandler可以继续生成响应
+func (c *Context) AbortWithError(code int, err error) *Error {
+	c.Status(code)
+	c.Abort()
+	return c.Error(err)
+}
+
+// 记录一个错误，err不是*Error时按ErrorTypePrivate记录。
+// 错误不会自动写入响应，可以在Engine.ErrorHandler中统一处理
+//
+//	if err := service.Save(); err != nil {
+//		c.Error(err).SetType(see.ErrorTypePublic)
+//		return
+//	}
+func (c *Context) Error(err error) *Error {
+	if err == nil {
+		panic("err is nil")
+	}
+	parsedError, ok := err.(*Error)
+	if !ok {
+		parsedError = &Error{
+			Err:  err,
+			Type: ErrorTypePrivate,
+		}
+	}
+	c.Errors = append(c.Errors, parsedError)
+	return parsedError
 }
 
-// 中断并抛出信息给用户，内部使用
-func (c *Context) fail(code int, err string) {
+// 中断并通过Engine.ErrorRenderer输出错误，内部使用
+func (c *Context) fail(e *HTTPError) {
 	c.Abort()
-	c.String(code, err)
+	c.RenderError(e)
 }
 
 // 为这个上下文存储一个新的键/值对。
@@ -497,7 +693,8 @@ func (c *Context) GetStringMapStringSlice(key string) (smss map[string][]string)
 // 数据绑定
 func (c *Context) Bind(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBind(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -533,7 +730,8 @@ func (c *Context) ShouldBind(obj interface{}, validationfunc ...map[string]valid
 
 func (c *Context) BindForm(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindForm(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -562,7 +760,8 @@ func (c *Context) ShouldBindForm(obj interface{}, validationfunc ...map[string]v
 
 func (c *Context) BindQuery(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindQuery(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -631,7 +830,8 @@ func (c *Context) ShouldBindQuery(obj interface{}, validationfunc ...map[string]
 
 func (c *Context) BindYAML(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindYAML(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -651,7 +851,8 @@ func (c *Context) ShouldBindYAML(obj interface{}, validationfunc ...map[string]v
 
 func (c *Context) BindXML(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindXML(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -671,7 +872,8 @@ func (c *Context) ShouldBindXML(obj interface{}, validationfunc ...map[string]va
 
 func (c *Context) BindJSON(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindJSON(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -691,7 +893,8 @@ func (c *Context) ShouldBindJSON(obj interface{}, validationfunc ...map[string]v
 
 func (c *Context) BindUri(obj interface{}, validationfunc ...map[string]validator.Func) error {
 	if e := c.ShouldBindUri(obj, validationfunc...); e != nil {
-		c.fail(400, e.Error())
+		c.Error(e).SetType(ErrorTypeBind)
+		c.fail(bindError(e))
 		return e
 	}
 	return nil
@@ -714,7 +917,7 @@ func (c *Context) validate(obj interface{}, validationfunc ...map[string]validat
 		}
 	}
 	if v.Verify() == false {
-		return v.GetErrors(verify.ZH)[0]
+		return newValidationError(obj, v.GetErrors(verify.EN), v.GetErrors(verify.ZH))
 	}
 	return nil
 }
@@ -0,0 +1,193 @@
+package see
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 签名校验或解密失败
+var ErrInvalidCookie = errors.New("see: invalid cookie value")
+
+// Cookie的可选属性，Path为空时为 /
+type CookieOptions struct {
+	Path    string
+	Domain  string
+	Expires time.Time
+	// 有效期（秒），0表示不设置，负数表示立即删除
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	// 按顶级站点分区存储（CHIPS），需要同时设置Secure
+	Partitioned bool
+}
+
+// 设置Cookie，value会经过URL编码
+//
+//	c.SetCookie("lang", "zh-CN", see.CookieOptions{MaxAge: 86400, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+func (c *Context) SetCookie(name, value string, options ...CookieOptions) {
+	var opt CookieOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	if opt.Path == "" {
+		opt.Path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		Path:     opt.Path,
+		Domain:   opt.Domain,
+		Expires:  opt.Expires,
+		MaxAge:   opt.MaxAge,
+		Secure:   opt.Secure,
+		HttpOnly: opt.HttpOnly,
+		SameSite: opt.SameSite,
+	}
+	if v := cookie.String(); v != "" {
+		if opt.Partitioned {
+			v += "; Partitioned"
+		}
+		c.Writer.Header().Add("Set-Cookie", v)
+	}
+}
+
+// 返回请求中的Cookie，不存在时返回http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// 删除Cookie，Path和Domain需要和设置时相同
+func (c *Context) DeleteCookie(name string, options ...CookieOptions) {
+	var opt CookieOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	opt.MaxAge = -1
+	opt.Expires = time.Unix(0, 0)
+	c.SetCookie(name, "", opt)
+}
+
+// 设置使用Engine.CookieKeys签名的Cookie，客户端可以读取但不能修改
+func (c *Context) SetSignedCookie(name, value string, options ...CookieOptions) {
+	keys := c.engine.CookieKeys
+	if len(keys) == 0 {
+		panic("see: Engine.CookieKeys is empty")
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	signature := base64.RawURLEncoding.EncodeToString(signCookie(keys[0], name, payload))
+	c.SetCookie(name, payload+"."+signature, options...)
+}
+
+// 返回校验签名后的Cookie，依次使用Engine.CookieKeys中的密钥校验，
+// 签名不正确时返回ErrInvalidCookie
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys := c.engine.CookieKeys
+	if len(keys) == 0 {
+		panic("see: Engine.CookieKeys is empty")
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", ErrInvalidCookie
+	}
+	payload := value[:i]
+	signature, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal(signature, signCookie(key, name, payload)) {
+			data, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(data), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// 签名包含Cookie名称，防止把一个Cookie的值用在另一个Cookie上
+func signCookie(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// 设置使用Engine.CookieEncryptionKeys加密（AES-GCM）的Cookie，客户端不能读取和修改
+func (c *Context) SetEncryptedCookie(name, value string, options ...CookieOptions) {
+	keys := c.engine.CookieEncryptionKeys
+	if len(keys) == 0 {
+		panic("see: Engine.CookieEncryptionKeys is empty")
+	}
+	aead, err := newCookieCipher(keys[0])
+	if err != nil {
+		panic(err)
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	data := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.SetCookie(name, base64.RawURLEncoding.EncodeToString(data), options...)
+}
+
+// 返回解密后的Cookie，依次使用Engine.CookieEncryptionKeys中的密钥解密，
+// 解密失败时返回ErrInvalidCookie
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	keys := c.engine.CookieEncryptionKeys
+	if len(keys) == 0 {
+		panic("see: Engine.CookieEncryptionKeys is empty")
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		aead, err := newCookieCipher(key)
+		if err != nil {
+			return "", err
+		}
+		if len(data) < aead.NonceSize() {
+			return "", ErrInvalidCookie
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// 密钥长度为16、24或32字节，分别对应AES-128、AES-192和AES-256
+func newCookieCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
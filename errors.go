@@ -0,0 +1,156 @@
+package see
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/junbin-yang/golib/json"
+)
+
+// 错误类型，可以按位组合
+type ErrorType uint64
+
+const (
+	// 绑定参数失败，Bind系列方法自动记录
+	ErrorTypeBind ErrorType = 1 << 63
+	// 输出响应失败，JSON、XML等方法自动记录
+	ErrorTypeRender ErrorType = 1 << 62
+	// 内部错误，不应该返回给客户端，c.Error的默认类型
+	ErrorTypePrivate ErrorType = 1 << 0
+	// 可以返回给客户端的错误
+	ErrorTypePublic ErrorType = 1 << 1
+	// 任意类型
+	ErrorTypeAny ErrorType = 1<<64 - 1
+)
+
+// 处理请求过程中记录的错误，见c.Error
+type Error struct {
+	Err  error
+	Type ErrorType
+	Meta interface{}
+}
+
+type errorMsgs []*Error
+
+var _ error = &Error{}
+
+func (e *Error) SetType(flags ErrorType) *Error {
+	e.Type = flags
+	return e
+}
+
+// 设置附加信息，H或map[string]interface{}会合并到JSON()的结果中
+func (e *Error) SetMeta(data interface{}) *Error {
+	e.Meta = data
+	return e
+}
+
+// 返回可以序列化为JSON的内容
+func (e *Error) JSON() interface{} {
+	jsonData := H{}
+	if e.Meta != nil {
+		value := reflect.ValueOf(e.Meta)
+		switch value.Kind() {
+		case reflect.Struct:
+			return e.Meta
+		case reflect.Map:
+			for _, key := range value.MapKeys() {
+				jsonData[fmt.Sprint(key.Interface())] = value.MapIndex(key).Interface()
+			}
+		default:
+			jsonData["meta"] = e.Meta
+		}
+	}
+	if _, ok := jsonData["error"]; !ok {
+		jsonData["error"] = e.Error()
+	}
+	return jsonData
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.JSON())
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) IsType(flags ErrorType) bool {
+	return (e.Type & flags) > 0
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 返回指定类型的错误
+func (a errorMsgs) ByType(typ ErrorType) errorMsgs {
+	if len(a) == 0 {
+		return nil
+	}
+	if typ == ErrorTypeAny {
+		return a
+	}
+	var result errorMsgs
+	for _, msg := range a {
+		if msg.IsType(typ) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// 返回最后一个错误，没有错误时返回nil
+func (a errorMsgs) Last() *Error {
+	if length := len(a); length > 0 {
+		return a[length-1]
+	}
+	return nil
+}
+
+// 返回所有错误信息
+func (a errorMsgs) Errors() []string {
+	if len(a) == 0 {
+		return nil
+	}
+	errorStrings := make([]string, len(a))
+	for i, err := range a {
+		errorStrings[i] = err.Error()
+	}
+	return errorStrings
+}
+
+// 只有一个错误时返回该错误的JSON()，多个时返回数组
+func (a errorMsgs) JSON() interface{} {
+	switch length := len(a); length {
+	case 0:
+		return nil
+	case 1:
+		return a.Last().JSON()
+	default:
+		jsonData := make([]interface{}, length)
+		for i, err := range a {
+			jsonData[i] = err.JSON()
+		}
+		return jsonData
+	}
+}
+
+func (a errorMsgs) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.JSON())
+}
+
+func (a errorMsgs) String() string {
+	if len(a) == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	for i, msg := range a {
+		fmt.Fprintf(&buffer, "Error #%02d: %s\n", i+1, msg.Err)
+		if msg.Meta != nil {
+			fmt.Fprintf(&buffer, "     Meta: %v\n", msg.Meta)
+		}
+	}
+	return buffer.String()
+}
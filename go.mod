@@ -1,6 +1,6 @@
 module github.com/junbin-yang/see
 
-go 1.15
+go 1.16
 
 require (
 	github.com/bytedance/gopkg v0.0.0-20211117073611-9a8af3eefa95 // indirect
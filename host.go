@@ -0,0 +1,110 @@
+package see
+
+import (
+	"net"
+	"strings"
+)
+
+// 按Host头匹配的路由表
+type hostRoute struct {
+	pattern string
+	labels  []string // 按 . 分割后的域名，:name 匹配一级子域名
+	router  *route
+}
+
+// 返回只匹配指定Host的路由分组，域名中以 : 开头的部分匹配任意一级子域名，
+// 可以通过c.Param获取。匹配时忽略大小写和端口，完全相同的域名优先于带参数的域名，
+// 没有匹配的Host时使用Engine自身注册的路由
+//
+// api := router.Host("api.example.com")
+// tenant := router.Host(":tenant.example.com")
+// tenant.GET("/", func(c *see.Context) { c.String(200, c.Param("tenant")) })
+func (this *Engine) Host(pattern string) *routerGroup {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	h := newHostRoute(pattern)
+	this.modify(func(t *routeTable) {
+		if t.lookup(pattern) == nil {
+			h.router.noRoute = t.router.noRoute
+			h.router.noMethod = t.router.noMethod
+			t.addHost(h)
+		}
+	})
+	return &routerGroup{
+		engine: this,
+		parent: this.routerGroup,
+		host:   pattern,
+	}
+}
+
+func newHostRoute(pattern string) *hostRoute {
+	labels := strings.Split(pattern, ".")
+	for _, label := range labels {
+		if label == "" || label == ":" {
+			panic("invalid host pattern '" + pattern + "'")
+		}
+	}
+	r := newRoute()
+	r.host = pattern
+	return &hostRoute{pattern: pattern, labels: labels, router: r}
+}
+
+// 不带参数的域名排在带参数的前面，同类的按注册顺序
+func (t *routeTable) addHost(h *hostRoute) {
+	i := len(t.hosts)
+	if !strings.Contains(h.pattern, ":") {
+		for i = 0; i < len(t.hosts); i++ {
+			if strings.Contains(t.hosts[i].pattern, ":") {
+				break
+			}
+		}
+	}
+	t.hosts = append(t.hosts, nil)
+	copy(t.hosts[i+1:], t.hosts[i:])
+	t.hosts[i] = h
+}
+
+// 根据请求的Host头选择路由表，子域名参数保存到c.Params
+func (t *routeTable) hostRouter(c *Context) *route {
+	host := c.Req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	for _, h := range t.hosts {
+		if h.match(host, &c.Params) {
+			return h.router
+		}
+	}
+	return t.router
+}
+
+func (h *hostRoute) match(host string, params *Params) bool {
+	count := len(*params)
+	last := len(h.labels) - 1
+	for i, label := range h.labels {
+		part := host
+		if i < last {
+			j := strings.IndexByte(host, '.')
+			if j < 0 {
+				break
+			}
+			part, host = host[:j], host[j+1:]
+		} else if strings.IndexByte(host, '.') >= 0 {
+			break
+		}
+
+		if label[0] == ':' {
+			if part == "" {
+				break
+			}
+			*params = append(*params, Param{Key: label[1:], Value: part})
+		} else if !strings.EqualFold(label, part) {
+			break
+		}
+		if i == last {
+			return true
+		}
+	}
+	*params = (*params)[:count]
+	return false
+}
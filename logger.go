@@ -34,7 +34,7 @@ func Logger() HandlerFunc {
 		// 请求参数
 		userAgent := c.Req.Header["User-Agent"]
 		// 状态码
-		statusCode := c.StatusCode
+		statusCode := c.Writer.Status()
 		// 请求IP
 		clientIP := c.Req.RemoteAddr
 		// 写入
@@ -0,0 +1,217 @@
+package see
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/junbin-yang/golib/json"
+)
+
+// 框架生成的错误响应，如参数绑定失败、panic、404和405，由Engine.ErrorRenderer输出
+type HTTPError struct {
+	// HTTP状态码
+	Status int
+	// 错误类型的URI，为空时为 about:blank
+	Type string
+	// 错误类型的简短说明，为空时使用状态码对应的文本
+	Title string
+	// 本次错误的具体说明
+	Detail string
+	// 参数校验失败的字段
+	InvalidParams []InvalidParam
+	// 原始错误，可能为nil
+	Err error
+}
+
+// 校验失败的参数
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *HTTPError) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	return e.title()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) title() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return http.StatusText(e.Status)
+}
+
+// 输出错误响应，见TextErrorRenderer和ProblemJSONRenderer
+type ErrorRenderer func(c *Context, e *HTTPError)
+
+// 默认的错误响应，输出纯文本
+func TextErrorRenderer(c *Context, e *HTTPError) {
+	switch e.Status {
+	case http.StatusNotFound:
+		c.String(e.Status, "404 NOT FOUND: %s\n", c.Path)
+	case http.StatusMethodNotAllowed:
+		c.String(e.Status, "405 METHOD NOT ALLOWED: %s %s\n", c.Method, c.Path)
+	case http.StatusNotAcceptable:
+		c.String(e.Status, "406 NOT ACCEPTABLE: %s %s\n", c.Method, c.Path)
+	default:
+		c.String(e.Status, "%s", e.Error())
+	}
+}
+
+// 按RFC 7807输出 application/problem+json
+//
+//	{
+//		"type": "about:blank",
+//		"title": "Bad Request",
+//		"status": 400,
+//		"detail": "Age必须大于或等于18",
+//		"instance": "/users",
+//		"invalid-params": [{"name": "age", "reason": "Age必须大于或等于18"}]
+//	}
+func ProblemJSONRenderer(c *Context, e *HTTPError) {
+	problem := struct {
+		Type          string         `json:"type"`
+		Title         string         `json:"title"`
+		Status        int            `json:"status"`
+		Detail        string         `json:"detail,omitempty"`
+		Instance      string         `json:"instance"`
+		InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+	}{
+		Type:          e.Type,
+		Title:         e.title(),
+		Status:        e.Status,
+		Detail:        e.Detail,
+		Instance:      c.Req.URL.Path,
+		InvalidParams: e.InvalidParams,
+	}
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	c.SetHeader("Content-Type", "application/problem+json")
+	c.Status(e.Status)
+	if err := json.NewEncoder(c.Writer).Encode(problem); err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
+	}
+}
+
+// 使用Engine.ErrorRenderer输出错误响应
+func (c *Context) RenderError(e *HTTPError) {
+	renderer := c.engine.ErrorRenderer
+	if renderer == nil {
+		renderer = TextErrorRenderer
+	}
+	renderer(c, e)
+}
+
+// 参数校验失败，Error()返回第一条错误信息
+type ValidationError struct {
+	Err    error
+	Params []InvalidParam
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// fieldErrors为validator返回的错误，messages为对应的翻译，obj为校验的结构体
+func newValidationError(obj interface{}, fieldErrors, messages []error) error {
+	if len(messages) != len(fieldErrors) {
+		return fieldErrors[0]
+	}
+	e := &ValidationError{Err: messages[0]}
+	for i, err := range fieldErrors {
+		name := ""
+		if fe, ok := err.(validator.FieldError); ok {
+			name = paramName(reflect.TypeOf(obj), fe.StructNamespace())
+		}
+		e.Params = append(e.Params, InvalidParam{Name: name, Reason: messages[i].Error()})
+	}
+	return e
+}
+
+// 把字段路径转换为客户端提交的参数名，优先使用json标签，其次是form标签，
+// 如 User.Address.City 为 address.city，Items[0].Name 为 items[0].name
+func paramName(t reflect.Type, namespace string) string {
+	parts := strings.Split(namespace, ".")
+	// 去掉最外层的结构体名
+	parts = parts[1:]
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		index := ""
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			part, index = part[:i], part[i:]
+		}
+		t = indirectType(t)
+		var field reflect.StructField
+		ok := false
+		if t != nil && t.Kind() == reflect.Struct {
+			field, ok = t.FieldByName(part)
+		}
+		if !ok {
+			names = append(names, part+index)
+			t = nil
+			continue
+		}
+		t = field.Type
+		for n := strings.Count(index, "["); n > 0 && t != nil; n-- {
+			t = indirectType(t)
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				t = t.Elem()
+			default:
+				t = nil
+			}
+		}
+		name := tagName(field)
+		if name == "" {
+			// 没有标签的嵌入结构体，字段展开到外层
+			if field.Anonymous && index == "" {
+				continue
+			}
+			name = part
+		}
+		names = append(names, name+index)
+	}
+	return strings.Join(names, ".")
+}
+
+func tagName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		tag := field.Tag.Get(key)
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag != "" && tag != "-" {
+			return tag
+		}
+	}
+	return ""
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// 绑定参数失败时的错误响应
+func bindError(err error) *HTTPError {
+	e := &HTTPError{Status: http.StatusBadRequest, Detail: err.Error(), Err: err}
+	if ve, ok := err.(*ValidationError); ok {
+		e.InvalidParams = ve.Params
+	}
+	return e
+}
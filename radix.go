@@ -2,6 +2,8 @@ package see
 
 import (
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Param struct {
@@ -51,6 +53,8 @@ func longestCommonPrefix(a, b string) int {
 
 // Search for a wildcard segment and check the name for invalid characters.
 // Returns -1 as index, if no wildcard was found.
+// A param may carry a constraint enclosed in '<' and '>', e.g. ':id<int>',
+// characters inside the constraint are not interpreted.
 func findWildcard(path string) (wilcard string, i int, valid bool) {
 	// Find start
 	for start, c := range []byte(path) {
@@ -61,37 +65,75 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 
 		// Find end and check for invalid characters
 		valid = true
-		for end, c := range []byte(path[start+1:]) {
-			switch c {
-			case '/':
-				return path[start : start+1+end], start, valid
-			case ':', '*':
+		depth := 0
+		for end := start + 1; end < len(path); end++ {
+			switch c := path[end]; {
+			case depth > 0 && c == '\\':
+				// Escaped char inside the constraint
+				end++
+			case c == '<':
+				depth++
+			case depth > 0 && c == '>':
+				depth--
+			case depth > 0:
+			case c == '/':
+				return path[start:end], start, valid
+			case c == ':', c == '*':
 				valid = false
 			}
 		}
-		return path[start:], start, valid
+		return path[start:], start, valid && depth == 0
 	}
 	return "", -1, false
 }
 
+// Splits a wildcard into its name and constraint, e.g. ':id<int>' into
+// 'id' and 'int'. The constraint must close the wildcard.
+func splitWildcard(wildcard string) (key, expr string, valid bool) {
+	key = wildcard[1:]
+	i := strings.IndexByte(key, '<')
+	if i < 0 {
+		return key, "", true
+	}
+	key, expr = key[:i], key[i+1:]
+	if expr == "" || expr[len(expr)-1] != '>' {
+		return key, "", false
+	}
+	return key, expr[:len(expr)-1], true
+}
+
 type nodeType uint8
 
 const (
 	static nodeType = iota // default
-	root
 	param
 	catchAll
 )
 
+// Every node owns a piece of the path: static nodes a fixed string, param
+// nodes one path segment and catch-all nodes one or more segments including
+// the leading '/'. A catch-all at the end takes the rest of the path, one in
+// the middle as few segments as possible.
+// Static children are indexed by their first byte, wildcard children are kept
+// apart and ordered by priority: params with constraint, the plain param and
+// the catch-all. Static children are always tried before wildcard children.
 type node struct {
-	path      string
-	indices   string
-	wildChild bool
-	nType     nodeType
-	priority  uint32
-	children  []*node
-	handle    HandlerFunc
-	fullPath  string
+	path         string
+	indices      string
+	nType        nodeType
+	priority     uint32
+	children     []*node
+	wildChildren []*node
+	handle       HandlerFunc
+	fullPath     string
+	// 参数名和参数约束，只有param和catchAll节点才有
+	key        string
+	constraint *constraint
+	// 路由的注册信息和预编译的完整中间件链，只有保存handle的节点才有
+	route    *routeEntry
+	handlers []HandlerFunc
+	// 同一路由按API版本注册的其他处理函数，见routerGroup.Version
+	variants []*node
 }
 
 func NewTree() *node {
@@ -122,229 +164,486 @@ func (n *node) incrementChildPrio(pos int) int {
 }
 
 func (n *node) Insert(path string, handle HandlerFunc) {
-	fullPath := path
-	n.priority++
+	if err := n.insert(path, handle, nil); err != nil {
+		panic(err.Error())
+	}
+}
 
-	// Empty tree
-	if n.path == "" && n.indices == "" {
-		n.insertChild(path, fullPath, handle)
-		n.nType = root
-		return
+// Error returned when a path cannot be inserted into the tree. existing is the
+// leaf of the route it conflicts with, nil if the path itself is malformed.
+type treeError struct {
+	msg      string
+	existing *node
+}
+
+func (e *treeError) Error() string {
+	return e.msg
+}
+
+// Inserts the path into the tree. Optional params are expanded to one path
+// with and one without the param, all leaves keep the full path as given.
+// The paths are checked first, so an error leaves the tree untouched.
+func (n *node) insert(path string, handle HandlerFunc, route *routeEntry) error {
+	paths, err := n.checkInsert(path, route)
+	if err != nil {
+		return err
 	}
+	for _, p := range paths {
+		n.insertPath(p, path, handle, route)
+	}
+	return nil
+}
 
-	parentFullPathIndex := 0
-walk:
-	for {
-		// Find the longest common prefix.
-		// This also implies that the common prefix contains no ':' or '*'
-		// since the existing key can't contain those chars.
-		i := longestCommonPrefix(path, n.path)
-
-		// Split edge
-		if i < len(n.path) {
-			child := node{
-				path:      n.path[i:],
-				wildChild: n.wildChild,
-				nType:     static,
-				indices:   n.indices,
-				children:  n.children,
-				handle:    n.handle,
-				priority:  n.priority - 1,
-				fullPath:  n.fullPath,
-			}
-
-			n.children = []*node{&child}
-			// []byte for proper unicode char conversion, see #65
-			n.indices = string([]byte{n.path[i]})
-			n.path = path[:i]
-			n.handle = nil
-			n.wildChild = false
-			n.fullPath = fullPath[:parentFullPathIndex+i]
-		}
-
-		// Make new node a child of this node
-		if i < len(path) {
-			path = path[i:]
-
-			if n.wildChild {
-				n = n.children[0]
-				n.priority++
-
-				// Check if the wildcard matches
-				if len(path) >= len(n.path) && n.path == path[:len(n.path)] &&
-					// Adding a child to a catchAll is not possible
-					n.nType != catchAll &&
-					// Check for longer wildcard, e.g. :name and :names
-					(len(n.path) >= len(path) || path[len(n.path)] == '/') {
-					parentFullPathIndex += len(n.path)
-					continue walk
-				} else {
-					// Wildcard conflict
-					pathSeg := path
-					if n.nType != catchAll {
-						pathSeg = strings.SplitN(pathSeg, "/", 2)[0]
-					}
-					prefix := fullPath[:strings.Index(fullPath, pathSeg)] + n.path
-					panic("'" + pathSeg +
-						"' in new path '" + fullPath +
-						"' conflicts with existing wildcard '" + n.path +
-						"' in existing prefix '" + prefix +
-						"'")
-				}
+// Checks that the path can be inserted without modifying the tree and
+// returns its expanded paths.
+func (n *node) checkInsert(path string, route *routeEntry) ([]string, error) {
+	paths, err := expandOptional(path)
+	if err != nil {
+		return nil, err
+	}
+	version := ""
+	if route != nil {
+		version = route.version
+	}
+	if len(paths) > 1 {
+		// The expanded paths must not conflict with each other either, the
+		// scratch tree only needs a non-nil handle to mark the leaves
+		tree := NewTree()
+		placeholder := func(*Context) {}
+		for _, p := range paths {
+			if err := tree.check(p, version); err != nil {
+				return nil, err
 			}
+			tree.insertPath(p, path, placeholder, route)
+		}
+	}
+	for _, p := range paths {
+		if err := n.check(p, version); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
 
-			idxc := path[0]
-
-			// '/' after param
-			if n.nType == param && idxc == '/' && len(n.children) == 1 {
-				parentFullPathIndex += len(n.path)
-				n = n.children[0]
-				n.priority++
-				continue walk
+// Expands the optional params of path, e.g. "/docs/:version?/intro" into
+// "/docs/:version/intro" and "/docs/intro". An optional param must fill a
+// whole path segment. Of adjacent optional params only the trailing ones can
+// be left out, "/archive/:year?/:month?" gives "/archive/:year/:month",
+// "/archive/:year" and "/archive".
+func expandOptional(path string) ([]string, error) {
+	if !strings.Contains(path, "?") {
+		return []string{path}, nil
+	}
+	type expansion struct {
+		path    string
+		omitted bool // ends with a left out optional param
+	}
+	expansions := []expansion{{}}
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 || wildcard[0] != ':' || !strings.HasSuffix(wildcard, "?") {
+			end := len(path)
+			if i >= 0 {
+				end = i + len(wildcard)
+			}
+			for j := range expansions {
+				expansions[j].path += path[:end]
+				expansions[j].omitted = false
 			}
+			if i < 0 {
+				break
+			}
+			path = path[end:]
+			continue
+		}
+		if i == 0 || path[i-1] != '/' {
+			return nil, &treeError{msg: "optional param '" + wildcard + "' must fill a whole path segment"}
+		}
 
-			// Check if a child with the next path byte exists
-			for i, c := range []byte(n.indices) {
-				if c == idxc {
-					parentFullPathIndex += len(n.path)
-					i = n.incrementChildPrio(i)
-					n = n.children[i]
-					continue walk
-				}
+		prefix := path[:i-1]
+		for j, count := 0, len(expansions); j < count; j++ {
+			e := expansions[j]
+			if e.omitted && prefix == "" {
+				continue
 			}
+			expansions[j] = expansion{path: e.path + path[:i] + wildcard[:len(wildcard)-1]}
+			expansions = append(expansions, expansion{path: e.path + prefix, omitted: true})
+		}
+		path = path[i+len(wildcard):]
+	}
 
-			// Otherwise insert it
-			if idxc != ':' && idxc != '*' {
-				// []byte for proper unicode char conversion, see #65
-				n.indices += string([]byte{idxc})
-				child := &node{
-					fullPath: fullPath,
-				}
-				n.children = append(n.children, child)
-				n.incrementChildPrio(len(n.indices) - 1)
-				n = child
+	paths := make([]string, len(expansions))
+	for j, e := range expansions {
+		paths[j] = e.path
+		if paths[j] == "" {
+			paths[j] = "/"
+		}
+	}
+	return paths, nil
+}
+
+// Inserts a checked path, the leaf is registered with fullPath.
+func (n *node) insertPath(path, fullPath string, handle HandlerFunc, route *routeEntry) {
+	n.priority++
+
+	for {
+		wildcard, i, _ := findWildcard(path)
+
+		// The static part before the wildcard, a catch-all owns the '/' in
+		// front of it
+		prefix := path
+		if i >= 0 {
+			prefix = path[:i]
+			if wildcard[0] == '*' {
+				prefix = path[:i-1]
 			}
-			n.insertChild(path, fullPath, handle)
-			return
+		}
+		n = n.insertStatic(prefix, fullPath)
+		if i < 0 {
+			break
 		}
 
-		// Otherwise add handle to current node
-		if n.handle != nil {
-			panic("a handle is already registered for path '" + fullPath + "'")
+		path = path[len(prefix):]
+		if wildcard[0] == '*' {
+			wildcard = "/" + wildcard
+		}
+		n = n.insertWildcard(wildcard, fullPath)
+		path = path[len(wildcard):]
+		if path == "" {
+			break
 		}
-		n.handle = handle
-		n.fullPath = fullPath
+	}
+
+	// Add handle to the node the path ends at, other versions of the route
+	// are kept as variants
+	if n.handle != nil {
+		n.variants = append(n.variants, &node{handle: handle, fullPath: fullPath, route: route})
 		return
 	}
+	n.handle = handle
+	n.fullPath = fullPath
+	n.route = route
 }
 
-func (n *node) insertChild(path, fullPath string, handle HandlerFunc) {
+// Checks that the path is well-formed and does not conflict with the routes
+// in the tree, without modifying it. The same path can be registered once
+// per API version.
+func (n *node) check(path, version string) error {
+	fullPath := path
+	if path == "" || path[0] != '/' {
+		return &treeError{msg: "path must begin with '/' in path '" + fullPath + "'"}
+	}
+
+	// n follows the path as long as it exists in the tree, nil afterwards
+	afterCatchAll := false
 	for {
-		// Find prefix until first wildcard
 		wildcard, i, valid := findWildcard(path)
-		if i < 0 { // No wilcard found
+
+		prefix := path
+		if i >= 0 {
+			// The wildcard name must not contain ':' and '*'
+			if !valid {
+				return &treeError{msg: "only one wildcard per path segment is allowed, has: '" +
+					wildcard + "' in path '" + fullPath + "'"}
+			}
+			prefix = path[:i]
+			if wildcard[0] == '*' {
+				if i == 0 || path[i-1] != '/' {
+					return &treeError{msg: "no / before catch-all in path '" + fullPath + "'"}
+				}
+				prefix = path[:i-1]
+				if afterCatchAll && prefix == "" {
+					return &treeError{msg: "a catch-all must not follow another catch-all in path '" + fullPath + "'"}
+				}
+			}
+		}
+		if n != nil {
+			n = n.lookupStatic(prefix)
+		}
+		if i < 0 {
 			break
 		}
 
-		// The wildcard name must not contain ':' and '*'
-		if !valid {
-			panic("only one wildcard per path segment is allowed, has: '" +
-				wildcard + "' in path '" + fullPath + "'")
+		path = path[len(prefix):]
+		if wildcard[0] == '*' {
+			wildcard = "/" + wildcard
 		}
+		child, err := newWildcard(wildcard, fullPath)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			existing := n.wildChild(wildcard)
+			if existing == nil {
+				if conflict := n.conflictingWildcard(child); conflict != nil {
+					return &treeError{
+						msg: "'" + wildcard +
+							"' in new path '" + fullPath +
+							"' conflicts with existing wildcard '" + conflict.path +
+							"' in existing prefix '" + conflict.fullPath +
+							"'",
+						existing: conflict.leaf(),
+					}
+				}
+			}
+			n = existing
+		}
+		path = path[len(wildcard):]
+		if path == "" {
+			break
+		}
+		afterCatchAll = child.nType == catchAll
+	}
 
-		// Check if the wildcard has a name
-		if len(wildcard) < 2 {
-			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
+	if n != nil && n.handle != nil {
+		if existing := n.variant(version); existing != nil {
+			return &treeError{
+				msg:      "a handle is already registered for path '" + fullPath + "'",
+				existing: existing,
+			}
 		}
+	}
+	return nil
+}
+
+// Returns the API version the leaf is registered for, empty for all versions.
+func (n *node) version() string {
+	if n.route == nil {
+		return ""
+	}
+	return n.route.version
+}
 
-		// Check if this node has existing children which would be
-		// unreachable if we insert the wildcard here
-		if len(n.children) > 0 {
-			panic("wildcard segment '" + wildcard +
-				"' conflicts with existing children in path '" + fullPath + "'")
+// Returns the leaf or variant registered for exactly the given version.
+func (n *node) variant(version string) *node {
+	if n.version() == version {
+		return n
+	}
+	for _, v := range n.variants {
+		if v.version() == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// Returns the node the static path ends at, or nil if the path leaves the
+// tree.
+func (n *node) lookupStatic(path string) *node {
+	for len(path) > 0 {
+		child := n.staticChild(path)
+		if child == nil || !strings.HasPrefix(path, child.path) {
+			return nil
+		}
+		path = path[len(child.path):]
+		n = child
+	}
+	return n
+}
+
+// Returns the wildcard child with exactly the given pattern.
+func (n *node) wildChild(wildcard string) *node {
+	for _, child := range n.wildChildren {
+		if child.path == wildcard {
+			return child
 		}
+	}
+	return nil
+}
 
-		// param
-		if wildcard[0] == ':' {
-			if i > 0 {
-				// Insert prefix before the current wildcard
-				n.path = path[:i]
-				path = path[i:]
+// Wildcards at the same position must be distinguishable: only one catch-all,
+// one plain param and one param per constraint. Returns the wildcard child
+// the new child cannot be told apart from.
+func (n *node) conflictingWildcard(child *node) *node {
+	for _, existing := range n.wildChildren {
+		if existing.nType != child.nType {
+			continue
+		}
+		if child.nType == param && (existing.constraint == nil) != (child.constraint == nil) {
+			continue
+		}
+		if child.constraint != nil && existing.constraint.expr != child.constraint.expr {
+			continue
+		}
+		return existing
+	}
+	return nil
+}
+
+// Returns a node below n holding a handle, used to report conflicts.
+func (n *node) leaf() *node {
+	for n.handle == nil {
+		switch {
+		case len(n.children) > 0:
+			n = n.children[0]
+		case len(n.wildChildren) > 0:
+			n = n.wildChildren[0]
+		default:
+			return nil
+		}
+	}
+	return n
+}
+
+// Inserts the static string below n and returns the node it ends at.
+func (n *node) insertStatic(path, fullPath string) *node {
+walk:
+	for len(path) > 0 {
+		idxc := path[0]
+		for i, c := range []byte(n.indices) {
+			if c != idxc {
+				continue
 			}
 
-			n.wildChild = true
-			child := &node{
-				nType:    param,
-				path:     wildcard,
-				fullPath: fullPath,
+			// Find the longest common prefix, split on rune boundaries only,
+			// so that every child starts with a complete rune
+			child := n.children[i]
+			lcp := longestCommonPrefix(path, child.path)
+			for lcp > 0 && lcp < len(child.path) && !utf8.RuneStart(child.path[lcp]) {
+				lcp--
 			}
-			n.children = []*node{child}
-			n = child
-			n.priority++
-
-			// If the path doesn't end with the wildcard, then there
-			// will be another non-wildcard subpath starting with '/'
-			if len(wildcard) < len(path) {
-				path = path[len(wildcard):]
-				child := &node{
-					priority: 1,
-					fullPath: fullPath,
-				}
-				n.children = []*node{child}
-				n = child
+			if lcp == 0 {
+				// Same first byte but another rune
 				continue
 			}
+			n.incrementChildPrio(i)
+
+			// Split edge
+			if lcp < len(child.path) {
+				rest := &node{
+					path:         child.path[lcp:],
+					indices:      child.indices,
+					children:     child.children,
+					wildChildren: child.wildChildren,
+					handle:       child.handle,
+					priority:     child.priority - 1,
+					fullPath:     child.fullPath,
+					route:        child.route,
+					handlers:     child.handlers,
+					variants:     child.variants,
+				}
+				child.path = child.path[:lcp]
+				// []byte for proper unicode char conversion, see #65
+				child.indices = string([]byte{rest.path[0]})
+				child.children = []*node{rest}
+				child.wildChildren = nil
+				child.handle = nil
+				child.route = nil
+				child.handlers = nil
+				child.variants = nil
+			}
 
-			// Otherwise we're done. Insert the handle in the new leaf
-			n.handle = handle
-			return
+			n = child
+			path = path[lcp:]
+			continue walk
 		}
 
-		// catchAll
-		if i+len(wildcard) != len(path) {
-			panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
+		// Otherwise insert it
+		child := &node{
+			path:     path,
+			fullPath: fullPath,
 		}
+		// []byte for proper unicode char conversion, see #65
+		n.indices += string([]byte{idxc})
+		n.children = append(n.children, child)
+		n.incrementChildPrio(len(n.indices) - 1)
+		return child
+	}
+	return n
+}
 
-		if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
-			panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
-		}
+// Inserts the wildcard as a wildcard child of n and returns the child.
+func (n *node) insertWildcard(wildcard, fullPath string) *node {
+	// Wildcards with the same pattern share one node
+	if child := n.wildChild(wildcard); child != nil {
+		child.priority++
+		return child
+	}
 
-		// Currently fixed width 1 for '/'
-		i--
-		if path[i] != '/' {
-			panic("no / before catch-all in path '" + fullPath + "'")
-		}
+	// The wildcard has been checked before
+	child, _ := newWildcard(wildcard, fullPath)
+	child.priority = 1
 
-		n.path = path[:i]
+	// Keep wildcard children ordered by priority
+	pos := len(n.wildChildren)
+	for i, existing := range n.wildChildren {
+		if child.rank() < existing.rank() {
+			pos = i
+			break
+		}
+	}
+	n.wildChildren = append(n.wildChildren, nil)
+	copy(n.wildChildren[pos+1:], n.wildChildren[pos:])
+	n.wildChildren[pos] = child
+	return child
+}
 
-		// First node: catchAll node with empty path
-		child := &node{
-			wildChild: true,
-			nType:     catchAll,
-			fullPath:  fullPath,
+// Creates the node of a param (":name<expr>") or catch-all ("/*name")
+// wildcard.
+func newWildcard(wildcard, fullPath string) (*node, error) {
+	child := &node{
+		path:     wildcard,
+		nType:    param,
+		fullPath: fullPath,
+	}
+	var expr string
+	if wildcard[0] == '/' {
+		if strings.IndexByte(wildcard, '<') >= 0 {
+			return nil, &treeError{msg: "constraints are not allowed on catch-all in path '" + fullPath + "'"}
 		}
-		n.children = []*node{child}
-		n.indices = string('/')
-		n = child
-		n.priority++
-
-		// Second node: node holding the variable
-		child = &node{
-			path:     path[i:],
-			nType:    catchAll,
-			handle:   handle,
-			priority: 1,
-			fullPath: fullPath,
+		if strings.HasSuffix(wildcard, "?") {
+			return nil, &treeError{msg: "catch-all routes can not be optional in path '" + fullPath + "'"}
+		}
+		child.nType = catchAll
+		child.key = wildcard[2:]
+	} else {
+		var valid bool
+		if child.key, expr, valid = splitWildcard(wildcard); !valid {
+			return nil, &treeError{msg: "invalid constraint in wildcard '" + wildcard + "' in path '" + fullPath + "'"}
 		}
-		n.children = []*node{child}
+	}
 
-		return
+	// Check if the wildcard has a name
+	if child.key == "" {
+		return nil, &treeError{msg: "wildcards must be named with a non-empty name in path '" + fullPath + "'"}
 	}
+	if expr != "" {
+		var err error
+		if child.constraint, err = newConstraint(expr); err != nil {
+			return nil, &treeError{msg: "invalid constraint '" + expr + "' in path '" + fullPath + "': " + err.Error()}
+		}
+	}
+	return child, nil
+}
 
-	// If no wildcard was found, simply insert the path and handle
-	n.path = path
-	n.handle = handle
-	n.fullPath = fullPath
+// Matching order of wildcard children, lower first.
+func (n *node) rank() int {
+	switch {
+	case n.nType == param && n.constraint != nil:
+		return 0
+	case n.nType == param:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Returns the static child starting with the same rune as path.
+func (n *node) staticChild(path string) *node {
+	idxc := path[0]
+	for i, c := range []byte(n.indices) {
+		if c != idxc {
+			continue
+		}
+		child := n.children[i]
+		if c < utf8.RuneSelf {
+			return child
+		}
+		if _, size := utf8.DecodeRuneInString(child.path); strings.HasPrefix(path, child.path[:size]) {
+			return child
+		}
+	}
+	return nil
 }
 
 // Returns the value registered with the given path (key).
@@ -352,128 +651,356 @@ func (n *node) insertChild(path, fullPath string, handle HandlerFunc) {
 // made if a value exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) Search(path string, params *Params, handle *HandlerFunc) (fullPath string, tsr bool) {
+	leaf, tsr := n.getValue(path, params)
+	if leaf != nil {
+		*handle = leaf.handle
+		fullPath = leaf.fullPath
+	}
+	return
+}
+
+// Returns the node holding the handle registered with the given path, or nil
+// together with a TSR recommendation, see Search.
+func (n *node) getValue(path string, params *Params) (leaf *node, tsr bool) {
+	leaf = n.match(path, params, &tsr)
+	return
+}
+
+// Matches path against n and its descendants. Static children are tried
+// before wildcard children, params before the catch-all; when a branch fails
+// the params it saved are dropped and the next candidate is tried.
+func (n *node) match(path string, params *Params, tsr *bool) *node {
 walk: // Outer loop for walking the tree
 	for {
-		prefix := n.path
-		fullPath = n.fullPath
-		if len(path) > len(prefix) {
-			if path[:len(prefix)] == prefix {
-				path = path[len(prefix):]
-
-				// If this node does not have a wildcard (param or catchAll)
-				// child, we can just look up the next child node and continue
-				// to walk down the tree
-				if !n.wildChild {
-					idxc := path[0]
-					for i, c := range []byte(n.indices) {
-						if c == idxc {
-							n = n.children[i]
-							continue walk
-						}
-					}
-
-					// Nothing found.
-					// We can recommend to redirect to the same URL without a
-					// trailing slash if a leaf exists for that path.
-					tsr = (path == "/" && n.handle != nil)
-					return
+		switch n.nType {
+		case static:
+			prefix := n.path
+			if len(path) < len(prefix) || path[:len(prefix)] != prefix {
+				// Nothing found. We can recommend to redirect to the same URL
+				// with an extra trailing slash if a leaf exists for that path
+				if n.handle != nil && len(prefix) == len(path)+1 &&
+					prefix[len(path)] == '/' && path == prefix[:len(path)] {
+					*tsr = true
 				}
+				return nil
+			}
+			path = path[len(prefix):]
 
-				// Handle wildcard child
-				n = n.children[0]
-				switch n.nType {
-				case param:
-					// Find param end (either '/' or path end)
-					end := 0
-					for end < len(path) && path[end] != '/' {
-						end++
-					}
+		case param:
+			// Find param end (either '/' or path end)
+			end := 0
+			for end < len(path) && path[end] != '/' {
+				end++
+			}
+			if end == 0 || (n.constraint != nil && !n.constraint.match(path[:end])) {
+				return nil
+			}
+
+			// Save param value
+			// Expand slice within preallocated capacity
+			i := len(*params)
+			*params = (*params)[:i+1]
+			(*params)[i] = Param{
+				Key:   n.key,
+				Value: path[:end],
+			}
+			path = path[end:]
 
-					// Save param value
-					// Expand slice within preallocated capacity
-					i := len(*params)
-					*params = (*params)[:i+1]
+		case catchAll:
+			if len(path) == 0 || path[0] != '/' {
+				return nil
+			}
+
+			// Save param value
+			// Expand slice within preallocated capacity
+			i := len(*params)
+			*params = (*params)[:i+1]
+
+			// In the middle of the path take as few segments as possible,
+			// at least one, and try the rest of the path below
+			if len(n.children) > 0 {
+				for end := 2; end < len(path); end++ {
+					if path[end] != '/' {
+						continue
+					}
 					(*params)[i] = Param{
-						Key:   n.path[1:],
+						Key:   n.key,
 						Value: path[:end],
 					}
-
-					// We need to go deeper!
-					if end < len(path) {
-						if len(n.children) > 0 {
-							path = path[end:]
-							n = n.children[0]
-							continue walk
+					if child := n.staticChild(path[end:]); child != nil {
+						if leaf := child.match(path[end:], params, tsr); leaf != nil {
+							return leaf
 						}
-
-						// ... but we can't
-						tsr = (len(path) == end+1)
-						return
+						*params = (*params)[:i+1]
 					}
+				}
+			}
+			if n.handle == nil {
+				*params = (*params)[:i]
+				return nil
+			}
+			(*params)[i] = Param{
+				Key:   n.key,
+				Value: path,
+			}
+			return n
 
-					if n.handle != nil {
-						*handle = n.handle
-						return
-					} else if len(n.children) == 1 {
-						// No handle found. Check if a handle for this path + a
-						// trailing slash exists for TSR recommendation
-						n = n.children[0]
-						tsr = (n.path == "/" && n.handle != nil) || (n.path == "" && n.indices == "/")
-					}
+		default:
+			panic("invalid node type")
+		}
 
-					return
+		if path == "" {
+			// We should have reached the node containing the handle.
+			// Check if this node has a handle registered.
+			if n.handle != nil {
+				return n
+			}
 
-				case catchAll:
-					// Save param value
-					// Expand slice within preallocated capacity
-					i := len(*params)
-					*params = (*params)[:i+1]
-					(*params)[i] = Param{
-						Key:   n.path[2:],
-						Value: path,
-					}
+			// No handle found. Check if a handle for this path + a
+			// trailing slash exists for trailing slash recommendation
+			if child := n.staticChild("/"); child != nil && child.path == "/" && child.handle != nil {
+				*tsr = true
+			}
+			for _, child := range n.wildChildren {
+				if child.nType == catchAll && child.handle != nil {
+					*tsr = true
+				}
+			}
+			return nil
+		}
+
+		// We can recommend to redirect to the same URL without a trailing
+		// slash if a leaf exists for that path
+		if path == "/" && n.handle != nil {
+			*tsr = true
+		}
 
-					*handle = n.handle
-					return
+		child := n.staticChild(path)
 
-				default:
-					panic("invalid node type")
-				}
+		// Only one candidate, we can just continue to walk down the tree
+		if len(n.wildChildren) == 0 {
+			if child == nil {
+				return nil
 			}
-		} else if path == prefix {
-			// We should have reached the node containing the handle.
-			// Check if this node has a handle registered.
-			if n.handle != nil {
-				*handle = n.handle
-				return
+			n = child
+			continue walk
+		}
+		if child == nil && len(n.wildChildren) == 1 {
+			n = n.wildChildren[0]
+			continue walk
+		}
+
+		// Try every candidate in order, dropping the params of failed ones
+		count := len(*params)
+		if child != nil {
+			if leaf := child.match(path, params, tsr); leaf != nil {
+				return leaf
+			}
+			*params = (*params)[:count]
+		}
+		for _, child := range n.wildChildren {
+			if leaf := child.match(path, params, tsr); leaf != nil {
+				return leaf
 			}
+			*params = (*params)[:count]
+		}
+		return nil
+	}
+}
+
+// Makes a case-insensitive lookup of the given path and tries to find a handler.
+// It can optionally also fix trailing slashes.
+// It returns the case-corrected path and a bool indicating whether the lookup
+// was successful.
+func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (ciPath []byte, found bool) {
+	return n.findCaseInsensitivePathRec(
+		path,
+		make([]byte, 0, len(path)+1), // Preallocate enough memory for new path
+		fixTrailingSlash,
+	)
+}
 
-			// If there is no handle for this route, but this route has a
-			// wildcard child, there must be a handle for this path with an
-			// additional trailing slash
-			if path == "/" && n.wildChild && n.nType != root {
-				tsr = true
-				return
+// Recursive case-insensitive lookup function used by n.findCaseInsensitivePath
+func (n *node) findCaseInsensitivePathRec(path string, ciPath []byte, fixTrailingSlash bool) ([]byte, bool) {
+	switch n.nType {
+	case static:
+		end, ok := foldPrefix(path, n.path)
+		if !ok {
+			// Try to fix the path by adding a trailing slash
+			if fixTrailingSlash && n.handle != nil && strings.HasSuffix(n.path, "/") {
+				if end, ok := foldPrefix(path, n.path[:len(n.path)-1]); ok && end == len(path) {
+					return append(ciPath, n.path...), true
+				}
 			}
+			return ciPath, false
+		}
+		ciPath = append(ciPath, n.path...)
+		path = path[end:]
+
+	case param:
+		// Find param end (either '/' or path end)
+		end := 0
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		if end == 0 || (n.constraint != nil && !n.constraint.match(path[:end])) {
+			return ciPath, false
+		}
+		// Add param value to case insensitive path
+		ciPath = append(ciPath, path[:end]...)
+		path = path[end:]
 
-			// No handle found. Check if a handle for this path + a
-			// trailing slash exists for trailing slash recommendation
-			for i, c := range []byte(n.indices) {
-				if c == '/' {
-					n = n.children[i]
-					tsr = (len(n.path) == 1 && n.handle != nil) ||
-						(n.nType == catchAll && n.children[0].handle != nil)
-					return
+	case catchAll:
+		if len(path) == 0 || path[0] != '/' {
+			return ciPath, false
+		}
+		for end := 2; end < len(path) && len(n.children) > 0; end++ {
+			if path[end] != '/' {
+				continue
+			}
+			for _, child := range n.children {
+				if out, found := child.findCaseInsensitivePathRec(path[end:], append(ciPath, path[:end]...), fixTrailingSlash); found {
+					return out, true
 				}
 			}
-			return
 		}
+		if n.handle == nil {
+			return ciPath, false
+		}
+		return append(ciPath, path...), true
+	}
 
-		// Nothing found. We can recommend to redirect to the same URL with an
-		// extra trailing slash if a leaf exists for that path
-		tsr = (path == "/") ||
-			(len(prefix) == len(path)+1 && prefix[len(path)] == '/' &&
-				path == prefix[:len(prefix)-1] && n.handle != nil)
-		return
+	if path == "" {
+		// We should have reached the node containing the handle.
+		// Check if this node has a handle registered.
+		if n.handle != nil {
+			return ciPath, true
+		}
+
+		// No handle found.
+		// Try to fix the path by adding a trailing slash
+		if fixTrailingSlash {
+			if child := n.staticChild("/"); child != nil && child.path == "/" && child.handle != nil {
+				return append(ciPath, '/'), true
+			}
+			for _, child := range n.wildChildren {
+				if child.nType == catchAll && child.handle != nil {
+					return append(ciPath, '/'), true
+				}
+			}
+		}
+		return ciPath, false
+	}
+
+	// Both the uppercase and the lowercase rune might exist as a child
+	for _, child := range n.children {
+		if out, found := child.findCaseInsensitivePathRec(path, ciPath, fixTrailingSlash); found {
+			return out, true
+		}
+	}
+	for _, child := range n.wildChildren {
+		if out, found := child.findCaseInsensitivePathRec(path, ciPath, fixTrailingSlash); found {
+			return out, true
+		}
+	}
+
+	// Nothing found.
+	// Try to fix the path by removing a trailing slash
+	if fixTrailingSlash && path == "/" && n.handle != nil {
+		return ciPath, true
+	}
+	return ciPath, false
+}
+
+// Reports whether path starts with prefix under Unicode case-folding and
+// returns the length of the matching part of path.
+func foldPrefix(path, prefix string) (int, bool) {
+	end := 0
+	for _, pr := range prefix {
+		if end >= len(path) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRuneInString(path[end:])
+		if r != pr && !equalFoldRune(r, pr) {
+			return 0, false
+		}
+		end += size
+	}
+	return end, true
+}
+
+func equalFoldRune(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls fn for every node holding a handle and its variants, in tree order.
+func (n *node) walk(fn func(n *node)) {
+	if n.handle != nil {
+		fn(n)
+		for _, v := range n.variants {
+			fn(v)
+		}
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	for _, child := range n.wildChildren {
+		child.walk(fn)
+	}
+}
+
+// Returns a deep copy of the tree, sharing the registered routes.
+func (n *node) clone() *node {
+	cn := *n
+	if n.children != nil {
+		cn.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			cn.children[i] = child.clone()
+		}
+	}
+	if n.wildChildren != nil {
+		cn.wildChildren = make([]*node, len(n.wildChildren))
+		for i, child := range n.wildChildren {
+			cn.wildChildren[i] = child.clone()
+		}
+	}
+	if n.variants != nil {
+		cn.variants = make([]*node, len(n.variants))
+		for i, v := range n.variants {
+			cn.variants[i] = v.clone()
+		}
+	}
+	return &cn
+}
+
+// Returns a new tree holding all routes of n except the ones registered with
+// path, all its versions, together with the removed leaves. The tree is nil if
+// no route is left.
+func (n *node) remove(path string) (tree *node, removed []*node) {
+	tree = NewTree()
+	// Leaves of the expanded optional params share one full path
+	inserted := make(map[string]bool)
+	n.walk(func(l *node) {
+		key := l.fullPath + "\x00" + l.version()
+		if l.fullPath == path {
+			if !inserted[key] {
+				inserted[key] = true
+				removed = append(removed, l)
+			}
+			return
+		}
+		if !inserted[key] {
+			inserted[key] = true
+			tree.insert(l.fullPath, l.handle, l.route)
+		}
+	})
+	if len(removed) == 0 || (len(tree.children) == 0 && len(tree.wildChildren) == 0) {
+		tree = nil
 	}
+	return tree, removed
 }
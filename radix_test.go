@@ -35,3 +35,328 @@ func TestTrie(t *testing.T) {
 func f1(c *Context) {
 	fmt.Println("ok")
 }
+
+type testRequest struct {
+	path   string
+	route  string // 匹配到的路由，为空表示没有匹配
+	params Params
+}
+
+func checkRequests(t *testing.T, tree *node, requests []testRequest) {
+	t.Helper()
+	for _, request := range requests {
+		ps := make(Params, 0, 20)
+		var h HandlerFunc
+		fullPath, _ := tree.Search(request.path, &ps, &h)
+		if request.route == "" {
+			if h != nil {
+				t.Errorf("%s: got route %q, want no match", request.path, fullPath)
+			}
+			continue
+		}
+		if h == nil {
+			t.Errorf("%s: got no match, want route %q", request.path, request.route)
+			continue
+		}
+		if fullPath != request.route {
+			t.Errorf("%s: got route %q, want %q", request.path, fullPath, request.route)
+		}
+		if len(ps) != len(request.params) {
+			t.Errorf("%s: got params %v, want %v", request.path, ps, request.params)
+			continue
+		}
+		for i := range ps {
+			if ps[i] != request.params[i] {
+				t.Errorf("%s: got params %v, want %v", request.path, ps, request.params)
+				break
+			}
+		}
+	}
+}
+
+func newTestTree(routes ...string) *node {
+	tree := NewTree()
+	for _, route := range routes {
+		tree.Insert(route, f1)
+	}
+	return tree
+}
+
+func TestTreeConstraints(t *testing.T) {
+	tree := newTestTree(
+		"/user/:id<int>",
+		"/user/:name",
+		"/file/:name<[a-z]+\\.txt>",
+		"/file/:name<[a-z]+\\.txt>/raw",
+		"/file/*path",
+		"/item/:id<uuid>/:rev<uint>",
+		"/slash/:x<[^/]+>",
+	)
+
+	checkRequests(t, tree, []testRequest{
+		{"/user/42", "/user/:id<int>", Params{{"id", "42"}}},
+		{"/user/-7", "/user/:id<int>", Params{{"id", "-7"}}},
+		// 不满足约束时继续尝试其他路由
+		{"/user/tom", "/user/:name", Params{{"name", "tom"}}},
+		{"/file/readme.txt", "/file/:name<[a-z]+\\.txt>", Params{{"name", "readme.txt"}}},
+		{"/file/readme.txt/raw", "/file/:name<[a-z]+\\.txt>/raw", Params{{"name", "readme.txt"}}},
+		{"/file/README.md", "/file/*path", Params{{"path", "/README.md"}}},
+		{"/file/readme.txt/blame", "/file/*path", Params{{"path", "/readme.txt/blame"}}},
+		{"/item/123e4567-e89b-12d3-a456-426614174000/3", "/item/:id<uuid>/:rev<uint>",
+			Params{{"id", "123e4567-e89b-12d3-a456-426614174000"}, {"rev", "3"}}},
+		{"/item/123e4567-e89b-12d3-a456-426614174000/-3", "", nil},
+		{"/item/abc/3", "", nil},
+		{"/slash/a", "/slash/:x<[^/]+>", Params{{"x", "a"}}},
+	})
+}
+
+func TestTreeStaticAndWildcardSiblings(t *testing.T) {
+	tree := newTestTree(
+		"/users/new",
+		"/users/:id",
+		"/users/:id/posts",
+		"/users/*rest",
+		"/src/",
+		"/src/*filepath",
+		"/α/β",
+		"/α/γ",
+		"/ä",
+		"/ö",
+	)
+
+	checkRequests(t, tree, []testRequest{
+		// 静态 > 参数 > 通配
+		{"/users/new", "/users/new", nil},
+		{"/users/newer", "/users/:id", Params{{"id", "newer"}}},
+		{"/users/42", "/users/:id", Params{{"id", "42"}}},
+		{"/users/new/posts", "/users/:id/posts", Params{{"id", "new"}}},
+		{"/users/42/likes", "/users/*rest", Params{{"rest", "/42/likes"}}},
+		{"/src/", "/src/", nil},
+		{"/src/a/b", "/src/*filepath", Params{{"filepath", "/a/b"}}},
+		{"/α/γ", "/α/γ", nil},
+		{"/ö", "/ö", nil},
+		{"/ü", "", nil},
+	})
+}
+
+func TestTreeOptionalParams(t *testing.T) {
+	tree := newTestTree(
+		"/docs/:version?/intro",
+		"/docs/:version/faq",
+		"/lang/:code<[a-z]{2}>?",
+		"/archive/:year?/:month?",
+	)
+
+	checkRequests(t, tree, []testRequest{
+		{"/docs/v2/intro", "/docs/:version?/intro", Params{{"version", "v2"}}},
+		{"/docs/intro", "/docs/:version?/intro", nil},
+		{"/docs/v2/faq", "/docs/:version/faq", Params{{"version", "v2"}}},
+		{"/docs/faq", "", nil},
+		{"/lang/de", "/lang/:code<[a-z]{2}>?", Params{{"code", "de"}}},
+		{"/lang", "/lang/:code<[a-z]{2}>?", nil},
+		{"/lang/deu", "", nil},
+		{"/archive", "/archive/:year?/:month?", nil},
+		{"/archive/2024", "/archive/:year?/:month?", Params{{"year", "2024"}}},
+		{"/archive/2024/05", "/archive/:year?/:month?", Params{{"year", "2024"}, {"month", "05"}}},
+	})
+
+	// Both expanded paths conflict with existing routes
+	for _, route := range []string{"/docs/:v?/intro", "/docs/:version?/faq"} {
+		if err := tree.insert(route, f1, nil); err == nil {
+			t.Errorf("%s: expected conflict", route)
+		}
+	}
+	// Expanded paths conflicting with each other
+	if err := NewTree().insert("/x/:a?/:b", f1, nil); err == nil {
+		t.Error("/x/:a?/:b: expected conflict between expanded paths")
+	}
+
+	// Removing the route removes all its expanded paths
+	tree, removed := tree.remove("/docs/:version?/intro")
+	if len(removed) != 1 {
+		t.Fatal("route not removed")
+	}
+	checkRequests(t, tree, []testRequest{
+		{"/docs/v2/intro", "", nil},
+		{"/docs/intro", "", nil},
+		{"/docs/v2/faq", "/docs/:version/faq", Params{{"version", "v2"}}},
+		{"/archive/2024", "/archive/:year?/:month?", Params{{"year", "2024"}}},
+	})
+}
+
+func TestTreeMidPathCatchAll(t *testing.T) {
+	tree := newTestTree(
+		"/repos/*path/blob/:ref",
+		"/repos/*path/tree/:ref",
+		"/repos/*path/tree/:ref/raw",
+		"/repos/*path",
+		"/repos/new/blob/:ref",
+		"/repos/:owner/blob/:ref",
+		"/files/*dir/meta",
+	)
+
+	checkRequests(t, tree, []testRequest{
+		// 静态 > 参数 > 通配
+		{"/repos/new/blob/main", "/repos/new/blob/:ref", Params{{"ref", "main"}}},
+		{"/repos/tom/blob/main", "/repos/:owner/blob/:ref", Params{{"owner", "tom"}, {"ref", "main"}}},
+		{"/repos/tom/see/blob/main", "/repos/*path/blob/:ref",
+			Params{{"path", "/tom/see"}, {"ref", "main"}}},
+		{"/repos/a/b/c/tree/dev/raw", "/repos/*path/tree/:ref/raw",
+			Params{{"path", "/a/b/c"}, {"ref", "dev"}}},
+		// 尽量少地匹配路径
+		{"/repos/a/blob/b/blob/c", "/repos/*path/blob/:ref",
+			Params{{"path", "/a/blob/b"}, {"ref", "c"}}},
+		{"/repos/a/tree/b/tree/c", "/repos/*path/tree/:ref",
+			Params{{"path", "/a/tree/b"}, {"ref", "c"}}},
+		// 后面的部分都不匹配时由末尾的通配处理
+		{"/repos/a/b/blob", "/repos/*path", Params{{"path", "/a/b/blob"}}},
+		{"/repos/a/blob/main/x", "/repos/*path", Params{{"path", "/a/blob/main/x"}}},
+		// 至少匹配一级路径
+		{"/files/meta", "", nil},
+		{"/files//meta", "", nil},
+		{"/files/a/meta", "/files/*dir/meta", Params{{"dir", "/a"}}},
+		{"/files/a/b/meta", "/files/*dir/meta", Params{{"dir", "/a/b"}}},
+		{"/files/a/b", "", nil},
+	})
+
+	// No trailing slash redirect to a catch-all without handle
+	ps := make(Params, 0, 20)
+	if _, tsr := tree.getValue("/files", &ps); tsr {
+		t.Error("/files: unexpected trailing slash redirect")
+	}
+
+	out, found := tree.findCaseInsensitivePath("/REPOS/Tom/See/BLOB/main", false)
+	if !found || string(out) != "/repos/Tom/See/blob/main" {
+		t.Errorf("case insensitive: got %q, %v", out, found)
+	}
+}
+
+func TestTreeConflicts(t *testing.T) {
+	conflicts := [][]string{
+		{"/user/:id", "/user/:name"},
+		{"/user/:id<int>", "/user/:uid<int>"},
+		{"/src/*path", "/src/*file"},
+		{"/user/:id", "/user/:id"},
+	}
+	for _, routes := range conflicts {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: no panic for conflicting routes", routes)
+				}
+			}()
+			newTestTree(routes...)
+		}()
+	}
+
+	invalid := []string{
+		"user",
+		"/user/:id<int",
+		"/user/:id<int>x",
+		"/user/:id<[>",
+		"/src/*path<int>",
+		"/src/*a/*b",
+		"/src/*path?",
+		"/docs/v:version?",
+		"/src*path",
+		"/:a:b",
+		"/:",
+	}
+	for _, route := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic for invalid route", route)
+				}
+			}()
+			newTestTree(route)
+		}()
+	}
+}
+
+func TestTreeInsertErrorLeavesTreeUntouched(t *testing.T) {
+	tree := newTestTree("/user/:id", "/src/*path")
+	failed := []string{
+		"/user/:name/profile",
+		"/user/:id/*a<int>",
+		"/src/*file",
+		"/user/:id",
+	}
+	for _, route := range failed {
+		if err := tree.insert(route, f1, nil); err == nil {
+			t.Errorf("%s: expected error", route)
+		}
+	}
+	checkRequests(t, tree, []testRequest{
+		{"/user/7", "/user/:id", Params{{"id", "7"}}},
+		{"/user/7/profile", "", nil},
+		{"/src/a/b", "/src/*path", Params{{"path", "/a/b"}}},
+	})
+
+	// The existing route is reported with the conflict
+	err := tree.insert("/user/:name", f1, nil).(*treeError)
+	if err.existing == nil || err.existing.fullPath != "/user/:id" {
+		t.Errorf("conflict not reported with existing route: %v", err)
+	}
+}
+
+func TestTreeTrailingSlashRedirect(t *testing.T) {
+	tree := newTestTree(
+		"/hi",
+		"/b/",
+		"/search/:query",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/x/:id<int>",
+	)
+
+	tsrRoutes := []string{"/hi/", "/b", "/search/gopher/", "/cmd/vet", "/src", "/x/1/"}
+	for _, route := range tsrRoutes {
+		ps := make(Params, 0, 20)
+		var h HandlerFunc
+		if _, tsr := tree.Search(route, &ps, &h); h != nil || !tsr {
+			t.Errorf("%s: expected trailing slash recommendation", route)
+		}
+	}
+
+	noTsrRoutes := []string{"/", "/no", "/no/", "/x/a/", "/search/"}
+	for _, route := range noTsrRoutes {
+		ps := make(Params, 0, 20)
+		var h HandlerFunc
+		if _, tsr := tree.Search(route, &ps, &h); h != nil || tsr {
+			t.Errorf("%s: unexpected trailing slash recommendation", route)
+		}
+	}
+}
+
+func TestTreeFindCaseInsensitivePath(t *testing.T) {
+	tree := newTestTree(
+		"/hi",
+		"/doc/go_faq.html",
+		"/user/:id<int>",
+		"/src/*filepath",
+		"/ÄÖÜ/x",
+		"/u/äöü",
+	)
+
+	tests := []struct {
+		in, out string
+		found   bool
+	}{
+		{"/HI", "/hi", true},
+		{"/HI/", "/hi", true},
+		{"/DOC/GO_FAQ.HTML", "/doc/go_faq.html", true},
+		{"/USER/42", "/user/42", true},
+		{"/USER/abc", "", false},
+		{"/SRC/Some/File", "/src/Some/File", true},
+		{"/äöü/X", "/ÄÖÜ/x", true},
+		{"/U/ÄÖÜ", "/u/äöü", true},
+		{"/nothing", "", false},
+	}
+	for _, tt := range tests {
+		out, found := tree.findCaseInsensitivePath(tt.in, true)
+		if found != tt.found || (found && string(out) != tt.out) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.in, out, found, tt.out, tt.found)
+		}
+	}
+}
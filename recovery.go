@@ -14,7 +14,7 @@ func Recovery() HandlerFunc {
 			if err := recover(); err != nil {
 				message := fmt.Sprintf("%s", err)
 				log.Printf("%s\n\n", trace(message))
-				c.fail(http.StatusInternalServerError, "Internal Server Error")
+				c.fail(&HTTPError{Status: http.StatusInternalServerError})
 			}
 		}()
 
@@ -0,0 +1,118 @@
+package see
+
+import "net/http"
+
+// 资源路由的各个操作，资源类型实现其中需要的接口即可，见routerGroup.Resource
+type (
+	// GET /items
+	Lister interface {
+		List(*Context)
+	}
+	// GET /items/:id
+	Getter interface {
+		Get(*Context)
+	}
+	// HEAD /items/:id
+	HeadHandler interface {
+		Head(*Context)
+	}
+	// POST /items
+	Creator interface {
+		Create(*Context)
+	}
+	// PUT /items/:id
+	Updater interface {
+		Update(*Context)
+	}
+	// PATCH /items/:id
+	Patcher interface {
+		Patch(*Context)
+	}
+	// DELETE /items/:id
+	Deleter interface {
+		Delete(*Context)
+	}
+)
+
+// 资源路由的配置
+type ResourceOptions struct {
+	// 单个资源的参数名，默认为id，嵌套资源时需要区分，如 /users/:uid/posts/:id
+	Param string
+	// 单个操作的中间件，键为操作名：List、Get、Head、Create、Update、Patch、Delete
+	Middlewares map[string][]HandlerFunc
+}
+
+// 注册资源路由，根据resource实现的接口注册对应的操作：
+//
+//	GET    /items      List    Lister
+//	POST   /items      Create  Creator
+//	GET    /items/:id  Get     Getter
+//	HEAD   /items/:id  Head    HeadHandler
+//	PUT    /items/:id  Update  Updater
+//	PATCH  /items/:id  Patch   Patcher
+//	DELETE /items/:id  Delete  Deleter
+//
+// 返回单个资源路径的分组，可以继续注册嵌套资源
+//
+// users := router.Resource("/users", UserResource{}, see.ResourceOptions{Param: "uid"})
+// users.Resource("/posts", PostResource{}) // /users/:uid/posts、/users/:uid/posts/:id
+func (this *routerGroup) Resource(pattern string, resource interface{}, options ...ResourceOptions) *routerGroup {
+	var opt ResourceOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	if opt.Param == "" {
+		opt.Param = "id"
+	}
+	item := pattern + "/:" + opt.Param
+
+	type action struct {
+		name, method, path string
+		handler            HandlerFunc
+	}
+	var actions []action
+	if r, ok := resource.(Lister); ok {
+		actions = append(actions, action{"List", http.MethodGet, pattern, r.List})
+	}
+	if r, ok := resource.(Creator); ok {
+		actions = append(actions, action{"Create", http.MethodPost, pattern, r.Create})
+	}
+	if r, ok := resource.(Getter); ok {
+		actions = append(actions, action{"Get", http.MethodGet, item, r.Get})
+	}
+	if r, ok := resource.(HeadHandler); ok {
+		actions = append(actions, action{"Head", http.MethodHead, item, r.Head})
+	}
+	if r, ok := resource.(Updater); ok {
+		actions = append(actions, action{"Update", http.MethodPut, item, r.Update})
+	}
+	if r, ok := resource.(Patcher); ok {
+		actions = append(actions, action{"Patch", http.MethodPatch, item, r.Patch})
+	}
+	if r, ok := resource.(Deleter); ok {
+		actions = append(actions, action{"Delete", http.MethodDelete, item, r.Delete})
+	}
+	if len(actions) == 0 {
+		panic("resource '" + pattern + "' implements none of Lister, Getter, HeadHandler, Creator, Updater, Patcher and Deleter")
+	}
+
+	for name := range opt.Middlewares {
+		found := false
+		for _, a := range actions {
+			if a.name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic("resource '" + pattern + "' has no action '" + name + "' for middlewares")
+		}
+	}
+
+	for _, a := range actions {
+		middlewares := opt.Middlewares[a.name]
+		handler := append(middlewares[:len(middlewares):len(middlewares)], a.handler)
+		this.addRoute(a.method, a.path, handler)
+	}
+	return this.Group(item)
+}
@@ -1,19 +1,58 @@
 package see
 
 import (
+	"errors"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 type route struct {
+	// 路由表对应的Host，Engine自身的路由表为空
+	host string
 	// 存储每种请求方式的树根节点
-	roots   []*node
-	noRoute HandlerFunc
+	roots []*node
+	// roots中每个下标对应的请求方式，前面是标准请求方式，后面是注册的自定义请求方式
+	methods  []string
+	noRoute  HandlerFunc
+	noMethod HandlerFunc
+	// 没有匹配到路由时执行的全局中间件
+	handlers []HandlerFunc
 }
 
+// 路由的注册信息，保存在radix树的叶子节点上
+type routeEntry struct {
+	path        string        // 完整的路由规则
+	group       *routerGroup  // 注册路由的分组
+	name        string        // 路由名称，用于生成URL
+	version     string        // API版本，为空时匹配所有版本
+	source      string        // 注册路由的位置 file:line
+	middlewares []HandlerFunc // 单路由中间件
+}
+
+// 已注册路由的信息
+type RouteInfo struct {
+	Host        string // 通过Engine.Host注册的路由对应的域名，否则为空
+	Method      string
+	Path        string
+	Name        string   // 路由名称，没有命名时为空
+	Version     string   // 通过routerGroup.Version注册的API版本
+	Handler     string   // 处理函数名
+	Group       string   // 注册路由的分组前缀
+	Middlewares []string // 分组中间件和单路由中间件的函数名，按执行顺序排列
+	HandlerFunc HandlerFunc
+}
+
+type RoutesInfo []RouteInfo
+
+// 匹配所有请求方式的路由，只在请求方式自身的radix树中没有匹配时使用，见Mount
+const allMethods = "*"
+
 // 初始化路由
 func newRoute() *route {
 	r := &route{
-		roots: make([]*node, len(anyMethods)),
+		roots:   make([]*node, len(anyMethods)),
+		methods: append([]string(nil), anyMethods...),
 	}
 	return r
 }
@@ -39,42 +78,323 @@ func (r *route) getRootIndex(method string) int {
 	case http.MethodTrace:
 		return 8
 	}
+	// 自定义请求方式，数量很少，直接遍历
+	for i := len(anyMethods); i < len(r.methods); i++ {
+		if r.methods[i] == method {
+			return i
+		}
+	}
 	return -1
 }
 
-// 注册路由
-func (r *route) addRoute(method string, pattern string, handler HandlerFunc) {
+// 注册路由，路由规则有误或与已注册的路由冲突时返回错误，不会修改radix树
+func (r *route) addRoute(method string, pattern string, handler HandlerFunc, entry *routeEntry) error {
+	index := r.getRootIndex(method)
+	if index == -1 {
+		if !validMethod(method) {
+			return errors.New("invalid http method '" + method + "'")
+		}
+		index = len(r.methods)
+		r.methods = append(r.methods, method)
+		r.roots = append(r.roots, nil)
+	}
+	root := r.roots[index]
+	if root == nil {
+		root = NewTree()
+	}
+	if err := root.insert(pattern, handler, entry); err != nil {
+		return err
+	}
+	r.roots[index] = root
+	return nil
+}
+
+// 检查路由能否注册，不修改radix树
+func (r *route) checkRoute(method string, pattern string, entry *routeEntry) error {
 	index := r.getRootIndex(method)
 	if index == -1 {
-		panic("The http method error")
+		if !validMethod(method) {
+			return errors.New("invalid http method '" + method + "'")
+		}
+	}
+	root := NewTree()
+	if index != -1 && r.roots[index] != nil {
+		root = r.roots[index]
+	}
+	_, err := root.checkInsert(pattern, entry)
+	return err
+}
+
+// 删除路由的所有版本，返回被删除路由的注册信息，没有找到时返回nil
+func (r *route) removeRoute(method, pattern string) []*routeEntry {
+	index := r.getRootIndex(method)
+	if index == -1 || r.roots[index] == nil {
+		return nil
+	}
+	root, removed := r.roots[index].remove(pattern)
+	if len(removed) == 0 {
+		return nil
 	}
-	if r.roots[index] == nil {
-		r.roots[index] = NewTree()
+	r.roots[index] = root
+	entries := make([]*routeEntry, len(removed))
+	for i, leaf := range removed {
+		entries[i] = leaf.route
+	}
+	return entries
+}
+
+// 复制路由表，radix树深拷贝，路由的注册信息共用
+func (r *route) clone() *route {
+	cr := *r
+	cr.methods = append([]string(nil), r.methods...)
+	cr.roots = make([]*node, len(r.roots))
+	for i, root := range r.roots {
+		if root != nil {
+			cr.roots[i] = root.clone()
+		}
 	}
+	return &cr
+}
 
-	r.roots[index].Insert(pattern, handler)
+// 遍历每种请求方式的radix树，收集所有已注册的路由
+func (r *route) routes() RoutesInfo {
+	var routes RoutesInfo
+	for i, root := range r.roots {
+		if root == nil {
+			continue
+		}
+		method := r.methods[i]
+		// 可选参数展开后的多个叶子节点共用一个注册信息，只列出一次
+		seen := make(map[*routeEntry]bool)
+		root.walk(func(n *node) {
+			entry := n.route
+			if seen[entry] {
+				return
+			}
+			seen[entry] = true
+			middlewares := entry.group.combineHandlers(entry.middlewares)
+			names := make([]string, len(middlewares))
+			for i, m := range middlewares {
+				names[i] = nameOfFunction(m)
+			}
+			routes = append(routes, RouteInfo{
+				Host:        r.host,
+				Method:      method,
+				Path:        entry.path,
+				Name:        entry.name,
+				Version:     entry.version,
+				Handler:     nameOfFunction(n.handle),
+				Group:       entry.group.prefix,
+				Middlewares: names,
+				HandlerFunc: n.handle,
+			})
+		})
+	}
+	// 树中节点的顺序与优先级有关，按路径排序使结果稳定
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
 }
 
 // 获取路由，并且返回所有动态参数。
-func (r *route) getRoute(method string, path string, params *Params, handler *HandlerFunc) string {
+func (r *route) getValue(method string, path string, params *Params) (*node, bool) {
 	index := r.getRootIndex(method)
+	// 没有注册过的请求方式，当作没有匹配到路由
+	if index == -1 || r.roots[index] == nil {
+		return nil, false
+	}
 	// 将解析出来的路由参数赋值给了c.Params。这样就能够通过c.Param()访问到了
-	fullPath, _ := r.roots[index].Search(path, params, handler)
-	return fullPath
+	return r.roots[index].getValue(path, params)
 }
 
 // 找到并执行处理请求函数
 func (r *route) handle(c *Context) {
-	r.getRoute(c.Method, c.Path, &c.Params, &c.lastHandler)
-	// 没有匹配到路由
-	if c.lastHandler == nil {
-		if r.noRoute == nil {
-			c.handlers = append(c.handlers, func(c *Context) {
-				c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
-			})
+	// 匹配Host时可能已经记录了子域名参数
+	count := len(c.Params)
+	leaf, tsr := r.getValue(c.Method, c.Path, &c.Params)
+	if leaf == nil {
+		// 包括自定义请求方式在内，没有单独注册的请求方式交给Mount挂载的处理函数
+		c.Params = c.Params[:count]
+		if l, _ := r.getValue(allMethods, c.Path, &c.Params); l != nil {
+			leaf = l
 		} else {
-			c.handlers = append(c.handlers, r.noRoute)
+			c.Params = c.Params[:count]
+		}
+	}
+	if leaf != nil && (leaf.variants != nil || leaf.route.version != "") {
+		// 按请求的API版本选择处理函数
+		if leaf = selectVersion(c, leaf); leaf == nil {
+			c.Params = c.Params[:count]
+			c.handlers = append(c.handlers, r.handlers...)
+			c.lastHandler = notAcceptable
+			c.Next()
+			return
+		}
+	}
+	if leaf != nil {
+		// 一次查找就得到预编译好的中间件链
+		c.handlers = append(c.handlers, leaf.handlers...)
+		c.lastHandler = leaf.handle
+		c.Next()
+		return
+	}
+
+	// 没有匹配到路由，丢弃查找过程中记录的参数，只执行全局中间件
+	c.Params = c.Params[:count]
+	c.handlers = append(c.handlers, r.handlers...)
+	if c.Method != http.MethodConnect && c.Path != "/" {
+		engine := c.engine
+		if tsr && engine.RedirectTrailingSlash {
+			c.lastHandler = redirectTrailingSlash
+		} else if engine.RedirectFixedPath && r.fixedPath(c) {
+			c.lastHandler = redirectFixedPath
+		}
+	}
+	if c.lastHandler == nil {
+		engine := c.engine
+		if c.Method == http.MethodOptions && engine.HandleOPTIONS {
+			// 自动响应OPTIONS请求
+			if allow := r.allowed(c, c.Path, http.MethodOptions); allow != "" {
+				c.SetHeader("Allow", allow)
+				c.lastHandler = handleOptions
+			}
+		} else if engine.HandleMethodNotAllowed {
+			// 路径存在但请求方式不匹配
+			if allow := r.allowed(c, c.Path, c.Method); allow != "" {
+				c.SetHeader("Allow", allow)
+				c.lastHandler = r.noMethod
+				if c.lastHandler == nil {
+					c.lastHandler = methodNotAllowed
+				}
+			}
+		}
+	}
+	if c.lastHandler == nil {
+		c.lastHandler = r.noRoute
+		if c.lastHandler == nil {
+			c.lastHandler = notFound
 		}
 	}
 	c.Next()
 }
+
+// 返回该路径允许的请求方式，用于Allow头，没有则返回空字符串。
+// path为*时返回所有注册过路由的请求方式
+func (r *route) allowed(c *Context, path, reqMethod string) string {
+	var allowed []string
+	hasOptions := false
+	for i, root := range r.roots {
+		if root == nil {
+			continue
+		}
+		method := r.methods[i]
+		if method == allMethods {
+			continue
+		}
+		if path != "*" {
+			if method == reqMethod {
+				continue
+			}
+			// 借用c.Params查找，结束后恢复
+			var handle HandlerFunc
+			n := len(c.Params)
+			root.Search(path, &c.Params, &handle)
+			c.Params = c.Params[:n]
+			if handle == nil {
+				continue
+			}
+		}
+		if method == http.MethodOptions {
+			hasOptions = true
+		}
+		allowed = append(allowed, method)
+	}
+	if len(allowed) == 0 {
+		return ""
+	}
+	if !hasOptions && c.engine.HandleOPTIONS {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
+
+// 请求方式必须是RFC 7230中定义的token，如 PROPFIND、MKCOL
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func handleOptions(c *Context) {
+	c.Status(http.StatusNoContent)
+}
+
+func notFound(c *Context) {
+	c.RenderError(&HTTPError{
+		Status: http.StatusNotFound,
+		Detail: "no route matches " + c.Method + " " + c.Path,
+	})
+}
+
+func methodNotAllowed(c *Context) {
+	c.RenderError(&HTTPError{
+		Status: http.StatusMethodNotAllowed,
+		Detail: "method " + c.Method + " is not allowed for " + c.Path,
+	})
+}
+
+// 清理路径并忽略大小写查找已注册的路由，找到时把修正后的路径记在c.Path
+func (r *route) fixedPath(c *Context) bool {
+	index := r.getRootIndex(c.Method)
+	if index == -1 || r.roots[index] == nil {
+		return false
+	}
+	fixedPath, found := r.roots[index].findCaseInsensitivePath(
+		cleanPath(c.Path),
+		c.engine.RedirectTrailingSlash,
+	)
+	if found {
+		c.Path = string(fixedPath)
+	}
+	return found
+}
+
+// 增加或去掉末尾的斜杠后重定向
+func redirectTrailingSlash(c *Context) {
+	p := c.Path
+	if len(p) > 1 && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
+	} else {
+		p = p + "/"
+	}
+	redirectRequest(c, p)
+}
+
+// 重定向到修正后的路径
+func redirectFixedPath(c *Context) {
+	redirectRequest(c, c.Path)
+}
+
+// GET请求使用301，其他请求使用308，保证客户端重发时不改变请求方式和请求体
+func redirectRequest(c *Context, location string) {
+	code := http.StatusMovedPermanently
+	if c.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	if q := c.Req.URL.RawQuery; q != "" {
+		location += "?" + q
+	}
+	c.Redirect(code, location)
+}
@@ -0,0 +1,1323 @@
+package see
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func performRequest(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	router := New()
+	router.GET("/users", func(c *Context) {})
+	router.GET("/posts/", func(c *Context) {})
+	router.POST("/users", func(c *Context) {})
+
+	tests := []struct {
+		method, path, location string
+		code                   int
+	}{
+		{"GET", "/users/", "/users", http.StatusMovedPermanently},
+		{"GET", "/posts", "/posts/", http.StatusMovedPermanently},
+		{"GET", "/users/?page=2", "/users?page=2", http.StatusMovedPermanently},
+		{"POST", "/users/", "/users", http.StatusPermanentRedirect},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, tt.method, tt.path)
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path,
+				w.Code, w.Header().Get("Location"), tt.code, tt.location)
+		}
+	}
+
+	router.RedirectTrailingSlash = false
+	if w := performRequest(router, "GET", "/users/"); w.Code != http.StatusNotFound {
+		t.Errorf("redirect disabled: got %d, want 404", w.Code)
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	router := New()
+	router.RedirectFixedPath = true
+	router.GET("/users", func(c *Context) {})
+	router.GET("/users/:id/profile", func(c *Context) {})
+
+	tests := []struct {
+		path, location string
+	}{
+		{"/USERS", "/users"},
+		{"/USERS/../users", "/users"},
+		{"//users", "/users"},
+		{"/Users/", "/users"},
+		{"/USERS/Abc/PROFILE", "/users/Abc/profile"},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s: got %d %q, want 301 %q", tt.path,
+				w.Code, w.Header().Get("Location"), tt.location)
+		}
+	}
+
+	if w := performRequest(router, "GET", "/nothing"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /nothing: got %d, want 404", w.Code)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := New()
+	router.GET("/items", func(c *Context) {})
+	router.DELETE("/items", func(c *Context) {})
+	router.GET("/items/:id", func(c *Context) {})
+
+	w := performRequest(router, "POST", "/items")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /items: got %d, want 405", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, OPTIONS" {
+		t.Errorf("POST /items: got Allow %q", allow)
+	}
+
+	router.NoMethod(func(c *Context) {
+		c.String(http.StatusMethodNotAllowed, "custom")
+	})
+	w = performRequest(router, "PUT", "/items/1")
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "custom" {
+		t.Errorf("PUT /items/1: got %d %q", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf("PUT /items/1: got Allow %q", allow)
+	}
+
+	if w := performRequest(router, "POST", "/nothing"); w.Code != http.StatusNotFound {
+		t.Errorf("POST /nothing: got %d, want 404", w.Code)
+	}
+
+	router.HandleMethodNotAllowed = false
+	if w := performRequest(router, "POST", "/items"); w.Code != http.StatusNotFound {
+		t.Errorf("405 disabled: got %d, want 404", w.Code)
+	}
+}
+
+func TestAutomaticOptions(t *testing.T) {
+	router := New()
+	router.GET("/items", func(c *Context) {})
+	router.POST("/items", func(c *Context) {})
+	router.OPTIONS("/custom", func(c *Context) {
+		c.Status(http.StatusTeapot)
+	})
+	router.GET("/custom", func(c *Context) {})
+
+	w := performRequest(router, "OPTIONS", "/items")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS /items: got %d, want 204", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("OPTIONS /items: got Allow %q", allow)
+	}
+
+	if w := performRequest(router, "OPTIONS", "/custom"); w.Code != http.StatusTeapot {
+		t.Errorf("OPTIONS /custom: got %d, want 418", w.Code)
+	}
+
+	router.HandleOPTIONS = false
+	w = performRequest(router, "OPTIONS", "/items")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("OPTIONS disabled: got %d %q, want 405", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	router := New()
+	router.Handle("PROPFIND", "/dav/*path", func(c *Context) {
+		c.String(http.StatusMultiStatus, c.Param("path"))
+	})
+	router.Handle("MKCOL", "/dav/*path", func(c *Context) {})
+	router.GET("/dav/*path", func(c *Context) {})
+
+	w := performRequest(router, "PROPFIND", "/dav/a/b")
+	if w.Code != http.StatusMultiStatus || w.Body.String() != "/a/b" {
+		t.Errorf("PROPFIND: got %d %q", w.Code, w.Body.String())
+	}
+
+	// 没有注册的请求方式不会panic
+	w = performRequest(router, "LOCK", "/dav/a")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("LOCK: got %d, want 405", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, MKCOL, OPTIONS, PROPFIND" {
+		t.Errorf("LOCK: got Allow %q", allow)
+	}
+	if w := performRequest(router, "PUT", "/other"); w.Code != http.StatusNotFound {
+		t.Errorf("PUT /other: got %d, want 404", w.Code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid method should panic at registration")
+		}
+	}()
+	router.Handle("BAD METHOD", "/x", func(c *Context) {})
+}
+
+func TestReservedAllMethods(t *testing.T) {
+	// * 只在Mount内部使用，不能直接注册
+	router := New()
+	router.CollectRouteErrors = true
+	router.Handle("*", "/x", func(c *Context) {})
+	if errs, ok := router.ValidateRoutes().(RouteErrors); !ok || len(errs) != 1 || errs[0].Method != "*" {
+		t.Errorf("got %v, want an error for method *", router.ValidateRoutes())
+	}
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
+
+func TestFreezeMiddlewareChain(t *testing.T) {
+	router := New()
+	var trace string
+	router.GET("/early", func(c *Context) { trace += "h" })
+	router.Use(func(c *Context) { trace += "a" })
+
+	performRequest(router, "GET", "/early")
+	if trace != "ah" {
+		t.Errorf("middleware registered after route: got %q, want %q", trace, "ah")
+	}
+
+	// 预编译之后注册的路由和中间件同样生效
+	router.Use(func(c *Context) { trace += "b" })
+	router.GET("/late", func(c *Context) { trace += "m" }, func(c *Context) { trace += "h" })
+	trace = ""
+	performRequest(router, "GET", "/late")
+	if trace != "abmh" {
+		t.Errorf("route registered after freeze: got %q", trace)
+	}
+}
+
+// 返回记录执行顺序的中间件
+func traceMiddleware(trace *[]string, name string) HandlerFunc {
+	return func(c *Context) {
+		*trace = append(*trace, name)
+	}
+}
+
+func TestGroupMiddlewareScoping(t *testing.T) {
+	var trace []string
+	router := New()
+	router.Use(traceMiddleware(&trace, "global"))
+
+	api := router.Group("/api")
+	api.Use(traceMiddleware(&trace, "api"))
+	api.GET("/users/:id", traceMiddleware(&trace, "user"))
+
+	v1 := api.Group("/v1")
+	v1.Use(traceMiddleware(&trace, "v1"))
+	v1.GET("/items", traceMiddleware(&trace, "items1"))
+
+	v2 := api.Group("/v2")
+	v2.Use(traceMiddleware(&trace, "v2"))
+	v2.GET("/items", traceMiddleware(&trace, "items2"))
+
+	router.GET("/apikeys", traceMiddleware(&trace, "apikeys"))
+	router.GET("/files/*path",
+		traceMiddleware(&trace, "route"),
+		traceMiddleware(&trace, "files"))
+	api.GET("/orders/:id",
+		traceMiddleware(&trace, "route1"),
+		traceMiddleware(&trace, "route2"),
+		traceMiddleware(&trace, "order"))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		// 前缀相同但不属于/api分组
+		{"/apikeys", "global apikeys"},
+		{"/api/users/1", "global api user"},
+		// 兄弟分组互不影响
+		{"/api/v1/items", "global api v1 items1"},
+		{"/api/v2/items", "global api v2 items2"},
+		// 带参数的路由同样执行单路由中间件
+		{"/files/a/b.txt", "global route files"},
+		{"/api/orders/42", "global api route1 route2 order"},
+		// 没有匹配到路由时只执行全局中间件
+		{"/api/unknown", "global"},
+	}
+	for _, tt := range tests {
+		trace = trace[:0]
+		performRequest(router, "GET", tt.path)
+		if got := strings.Join(trace, " "); got != tt.want {
+			t.Errorf("GET %s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGroupMiddlewareRegisteredLater(t *testing.T) {
+	var trace []string
+	router := New()
+	admin := router.Group("/admin")
+	admin.GET("/stats", traceMiddleware(&trace, "stats"))
+	// 在路由之后注册的分组中间件同样生效
+	admin.Use(traceMiddleware(&trace, "auth"))
+	router.Use(traceMiddleware(&trace, "global"))
+
+	performRequest(router, "GET", "/admin/stats")
+	if got := strings.Join(trace, " "); got != "global auth stats" {
+		t.Errorf("got %q, want %q", got, "global auth stats")
+	}
+}
+
+func authMiddleware(c *Context) {}
+
+func listUsers(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	router := New()
+	api := router.Group("/api")
+	api.Use(authMiddleware)
+	api.GET("/users", listUsers)
+	api.POST("/users/:id", authMiddleware, listUsers)
+	router.Handle("PROPFIND", "/dav/*path", listUsers)
+
+	routes := router.Routes()
+	if len(routes) != 3 {
+		t.Fatalf("got %d routes, want 3", len(routes))
+	}
+	want := []struct {
+		method, path, group string
+		middlewares         int
+	}{
+		{"GET", "/api/users", "/api", 1},
+		{"POST", "/api/users/:id", "/api", 2},
+		{"PROPFIND", "/dav/*path", "", 0},
+	}
+	for i, w := range want {
+		r := routes[i]
+		if r.Method != w.method || r.Path != w.path || r.Group != w.group || len(r.Middlewares) != w.middlewares {
+			t.Errorf("routes[%d]: got %+v", i, r)
+		}
+		if !strings.HasSuffix(r.Handler, ".listUsers") {
+			t.Errorf("routes[%d]: got handler %q", i, r.Handler)
+		}
+	}
+	if !strings.HasSuffix(routes[1].Middlewares[0], ".authMiddleware") {
+		t.Errorf("got middlewares %v", routes[1].Middlewares)
+	}
+}
+
+func TestNamedRoutes(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", func(c *Context) {}).Name("user")
+	router.Group("/files").GET("/:owner/*path", func(c *Context) {}).Name("file")
+	router.Any("/ping", func(c *Context) {}).Name("ping")
+
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"user", []string{"id", "42"}, "/users/42"},
+		{"user", []string{"id", "a/b c"}, "/users/a%2Fb%20c"},
+		{"file", []string{"owner", "tom", "path", "docs/a b.txt"}, "/files/tom/docs/a%20b.txt"},
+		{"file", []string{"path", "/x", "owner", "tom"}, "/files/tom/x"},
+		{"ping", nil, "/ping"},
+	}
+	for _, tt := range tests {
+		got, err := router.URL(tt.name, tt.params...)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v): got %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+
+	if _, err := router.URL("user"); err == nil {
+		t.Error("missing param should return an error")
+	}
+	if _, err := router.URL("user", "id"); err == nil {
+		t.Error("odd params should return an error")
+	}
+	if _, err := router.URL("nothing"); err == nil {
+		t.Error("unknown name should return an error")
+	}
+
+	router.GET("/link", func(c *Context) {
+		u, _ := c.URLFor("user", "id", "7")
+		c.String(http.StatusOK, u)
+	})
+	if w := performRequest(router, "GET", "/link"); w.Body.String() != "/users/7" {
+		t.Errorf("URLFor: got %q", w.Body.String())
+	}
+}
+
+func TestParamConstraints(t *testing.T) {
+	router := New()
+	router.GET("/user/:id<int>", func(c *Context) {
+		id, err := c.ParamInt("id")
+		if err != nil {
+			t.Error(err)
+		}
+		c.String(http.StatusOK, "%d", id+1)
+	})
+	router.GET("/user/:id<int>/name", func(c *Context) {}).Name("name")
+
+	if w := performRequest(router, "GET", "/user/41"); w.Body.String() != "42" {
+		t.Errorf("GET /user/41: got %d %q", w.Code, w.Body.String())
+	}
+	if w := performRequest(router, "GET", "/user/abc"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /user/abc: got %d, want 404", w.Code)
+	}
+	if u, _ := router.URL("name", "id", "7"); u != "/user/7/name" {
+		t.Errorf("URL with constraint: got %q", u)
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	router := New()
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, "default") })
+	router.Host("api.example.com").GET("/", func(c *Context) { c.String(http.StatusOK, "api") })
+	tenant := router.Host(":tenant.example.com").Group("/v1")
+	tenant.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, c.Param("tenant")+" "+c.Param("id"))
+	})
+
+	tests := []struct {
+		url, body string
+		code      int
+	}{
+		{"http://example.com/", "default", http.StatusOK},
+		{"http://API.example.com:8080/", "api", http.StatusOK},
+		{"http://acme.example.com/v1/users/7", "acme 7", http.StatusOK},
+		{"http://acme.example.com/", "", http.StatusNotFound},
+		{"http://a.b.example.com/v1/users/7", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, "GET", tt.url)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("GET %s: got %d %q, want %d %q", tt.url, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+
+	routes := router.Routes()
+	if len(routes) != 3 || routes[0].Host != "" || routes[1].Host != "api.example.com" || routes[2].Host != ":tenant.example.com" {
+		t.Errorf("unexpected routes: %+v", routes)
+	}
+}
+
+func TestMount(t *testing.T) {
+	var trace []string
+	router := New()
+	admin := router.Group("/admin")
+	admin.Use(traceMiddleware(&trace, "admin"))
+
+	sub := New()
+	sub.GET("/", func(c *Context) { c.String(http.StatusOK, "index") })
+	sub.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "user "+c.Param("id")) })
+	admin.Mount("/ui", sub)
+
+	router.Mount("/std", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	router.GET("/wrapped", WrapF(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wrapped"))
+	}))
+	router.POST("/std/special", func(c *Context) { c.String(http.StatusOK, "special") })
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/admin/ui", "index"},
+		{"GET", "/admin/ui/", "index"},
+		{"GET", "/admin/ui/users/7", "user 7"},
+		{"DELETE", "/std/a/b", "DELETE /a/b"},
+		{"GET", "/std", "GET /"},
+		{"PROPFIND", "/std/dav/file", "PROPFIND /dav/file"},
+		{"MKCOL", "/std/dav/dir", "MKCOL /dav/dir"},
+		{"POST", "/std/special", "special"},
+		{"GET", "/std/special", "GET /special"},
+		{"GET", "/wrapped", "wrapped"},
+	}
+	for _, tt := range tests {
+		trace = trace[:0]
+		w := performRequest(router, tt.method, tt.path)
+		if w.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %q", tt.method, tt.path, w.Code, w.Body.String(), tt.body)
+		}
+		if strings.HasPrefix(tt.path, "/admin") && strings.Join(trace, " ") != "admin" {
+			t.Errorf("%s: group middleware not applied: %v", tt.path, trace)
+		}
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	router := New()
+	router.CollectRouteErrors = true
+	router.GET("/users/:id", func(c *Context) {})
+	router.GET("/users/:name", func(c *Context) {})
+	router.GET("/files/*path<int>", func(c *Context) {})
+	router.GET("/ok", func(c *Context) {})
+	router.GET("/ok", func(c *Context) {})
+
+	err := router.ValidateRoutes()
+	errs, ok := err.(RouteErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("got %v, want 3 route errors", err)
+	}
+	if errs[0].Existing != "/users/:id" || errs[0].Path != "/users/:name" {
+		t.Errorf("param conflict: got %+v", errs[0])
+	}
+	for _, e := range errs {
+		if !strings.Contains(e.Source, "router_test.go:") {
+			t.Errorf("%s: got source %q", e.Path, e.Source)
+		}
+	}
+	if !strings.Contains(errs[2].ExistingSource, "router_test.go:") {
+		t.Errorf("duplicate route: got existing source %q", errs[2].ExistingSource)
+	}
+
+	// 注册失败的路由不影响其他路由
+	if w := performRequest(router, "GET", "/users/1"); w.Code != http.StatusOK {
+		t.Errorf("GET /users/1: got %d", w.Code)
+	}
+
+	// Any中有一个请求方式冲突时，所有请求方式都不注册
+	router.POST("/any", func(c *Context) {})
+	router.Any("/any", func(c *Context) {})
+	if errs := router.ValidateRoutes().(RouteErrors); len(errs) != 4 || errs[3].Method != "POST" {
+		t.Errorf("Any conflict: got %v", errs)
+	}
+	if w := performRequest(router, "GET", "/any"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /any: got %d, want 405", w.Code)
+	}
+
+	// 默认直接panic，且不会留下注册了一部分的Any路由
+	panicRouter := New()
+	panicRouter.POST("/any", func(c *Context) {})
+	func() {
+		defer func() {
+			if _, ok := recover().(*RouteError); !ok {
+				t.Error("conflicting route should panic with *RouteError")
+			}
+		}()
+		panicRouter.Any("/any", func(c *Context) {})
+	}()
+	if w := performRequest(panicRouter, "GET", "/any"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET after panicking Any: got %d, want 405", w.Code)
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	router := New()
+	router.Any("/plugins/:name", func(c *Context) {}).Name("plugin")
+	router.GET("/plugins/:name/status", func(c *Context) {})
+	api := router.Host("api.example.com")
+	api.GET("/ping", func(c *Context) {})
+
+	if w := performRequest(router, "GET", "/plugins/a"); w.Code != http.StatusOK {
+		t.Fatalf("GET /plugins/a: got %d", w.Code)
+	}
+	if !router.RemoveRoute("GET", "/plugins/:name") {
+		t.Fatal("route not removed")
+	}
+	if router.RemoveRoute("GET", "/plugins/:name") {
+		t.Error("removed route removed twice")
+	}
+	if w := performRequest(router, "GET", "/plugins/a"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET removed route: got %d, want 405", w.Code)
+	}
+	if w := performRequest(router, "GET", "/plugins/a/status"); w.Code != http.StatusOK {
+		t.Errorf("GET /plugins/a/status: got %d", w.Code)
+	}
+	// 其他请求方式仍然可以使用路由名称
+	if u, err := router.URL("plugin", "name", "a"); err != nil || u != "/plugins/a" {
+		t.Errorf("URL after removing GET: got %q, %v", u, err)
+	}
+
+	// Any删除所有请求方式，包括已经单独删除过的GET
+	if !router.RemoveRoute("Any", "/plugins/:name") {
+		t.Error("Any route not removed")
+	}
+	if w := performRequest(router, "POST", "/plugins/a"); w.Code != http.StatusNotFound {
+		t.Errorf("POST after removing Any: got %d, want 404", w.Code)
+	}
+	if _, err := router.URL("plugin", "name", "a"); err == nil {
+		t.Error("route name should be removed with the last method")
+	}
+	if router.RemoveRoute("Any", "/plugins/:name") {
+		t.Error("Any route removed twice")
+	}
+
+	if !api.RemoveRoute("GET", "/ping") {
+		t.Error("host route not removed")
+	}
+	if w := performRequest(router, "GET", "http://api.example.com/ping"); w.Code != http.StatusNotFound {
+		t.Errorf("GET removed host route: got %d, want 404", w.Code)
+	}
+}
+
+func TestHotSwapConcurrentServe(t *testing.T) {
+	router := New()
+	router.GET("/static", func(c *Context) {})
+	router.Freeze()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			path := "/dynamic/" + strconv.Itoa(i)
+			router.GET(path, func(c *Context) {})
+			router.RemoveRoute("GET", path)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if w := performRequest(router, "GET", "/static"); w.Code != http.StatusOK {
+			t.Fatalf("GET /static during swap: got %d", w.Code)
+		}
+	}
+	<-done
+	if routes := router.Routes(); len(routes) != 1 {
+		t.Errorf("got %d routes, want 1", len(routes))
+	}
+}
+
+func TestOptionalParams(t *testing.T) {
+	router := New()
+	router.GET("/docs/:version?/intro", func(c *Context) {
+		c.String(http.StatusOK, "intro %s", c.Param("version"))
+	}).Name("intro")
+
+	if w := performRequest(router, "GET", "/docs/intro"); w.Body.String() != "intro " {
+		t.Errorf("GET /docs/intro: got %d %q", w.Code, w.Body.String())
+	}
+	if w := performRequest(router, "GET", "/docs/v2/intro"); w.Body.String() != "intro v2" {
+		t.Errorf("GET /docs/v2/intro: got %d %q", w.Code, w.Body.String())
+	}
+	if u, _ := router.URL("intro"); u != "/docs/intro" {
+		t.Errorf("URL without optional param: got %q", u)
+	}
+	if u, _ := router.URL("intro", "version", "v2"); u != "/docs/v2/intro" {
+		t.Errorf("URL with optional param: got %q", u)
+	}
+	if routes := router.Routes(); len(routes) != 1 || routes[0].Path != "/docs/:version?/intro" {
+		t.Errorf("optional route listed more than once: %+v", routes)
+	}
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	router := New()
+	api := router.Group("/api")
+	api.GET("/users", func(c *Context) { c.String(http.StatusOK, "any") })
+	api.Version("1").GET("/users", func(c *Context) { c.String(http.StatusOK, "v1") })
+	api.Version("v2").GET("/users", func(c *Context) { c.String(http.StatusOK, "v2") })
+	api.Version("2").GET("/items", func(c *Context) { c.String(http.StatusOK, "items v2") })
+
+	tests := []struct {
+		path, header, value, body string
+		code                      int
+	}{
+		{"/api/users", "", "", "any", http.StatusOK},
+		{"/api/users", "X-API-Version", "1", "v1", http.StatusOK},
+		{"/api/users", "X-API-Version", "v2", "v2", http.StatusOK},
+		{"/api/users", "Accept", "application/vnd.acme.v2+json", "v2", http.StatusOK},
+		{"/api/users", "Accept", "text/html, application/vnd.acme+json; version=1", "v1", http.StatusOK},
+		{"/api/users", "Accept", "application/vnd.acme.V1", "v1", http.StatusOK},
+		// 以v开头的厂商名不是版本
+		{"/api/users", "Accept", "application/vnd.vimeo+json", "any", http.StatusOK},
+		{"/api/users", "Accept", "application/vnd.valve.v2+json", "v2", http.StatusOK},
+		{"/api/users", "Accept", "application/vnd.acme.vip+json", "any", http.StatusOK},
+		{"/api/items", "Accept", "application/vnd.acme.v2.1+json", "", http.StatusNotAcceptable},
+		{"/api/items", "Accept", "application/vnd.acme.1+json", "", http.StatusNotAcceptable},
+		// 没有对应版本时使用没有指定版本的路由
+		{"/api/users", "X-API-Version", "3", "any", http.StatusOK},
+		{"/api/items", "X-API-Version", "2", "items v2", http.StatusOK},
+		{"/api/items", "X-API-Version", "1", "", http.StatusNotAcceptable},
+		{"/api/items", "", "", "", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s %s=%q: got %d %q, want %d %q", tt.path, tt.header, tt.value,
+				w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+
+	// 带小版本号
+	api.Version("2.1").GET("/items", func(c *Context) { c.String(http.StatusOK, "items v2.1") })
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("Accept", "application/vnd.acme.v2.1+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() != "items v2.1" {
+		t.Errorf("minor version: got %d %q", w.Code, w.Body.String())
+	}
+
+	router.DefaultVersion = "2"
+	if w := performRequest(router, "GET", "/api/items"); w.Body.String() != "items v2" {
+		t.Errorf("default version: got %d %q", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate version should panic")
+		}
+	}()
+	api.Version("1").GET("/users", func(c *Context) {})
+}
+
+type userResource struct{}
+
+func (userResource) List(c *Context)   { c.String(http.StatusOK, "list users") }
+func (userResource) Get(c *Context)    { c.String(http.StatusOK, "get user "+c.Param("uid")) }
+func (userResource) Create(c *Context) { c.String(http.StatusCreated, "create user") }
+func (userResource) Patch(c *Context)  { c.String(http.StatusOK, "patch user "+c.Param("uid")) }
+
+type postResource struct{}
+
+func (postResource) List(c *Context) { c.String(http.StatusOK, "list posts of "+c.Param("uid")) }
+func (postResource) Delete(c *Context) {
+	c.String(http.StatusOK, "delete post "+c.Param("uid")+"/"+c.Param("id"))
+}
+
+func TestResource(t *testing.T) {
+	var trace []string
+	router := New()
+	users := router.Resource("/users", userResource{}, ResourceOptions{
+		Param:       "uid",
+		Middlewares: map[string][]HandlerFunc{"Create": {traceMiddleware(&trace, "auth")}},
+	})
+	users.Resource("/posts", postResource{})
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/users", "list users"},
+		{"GET", "/users/7", "get user 7"},
+		{"POST", "/users", "create user"},
+		{"PATCH", "/users/7", "patch user 7"},
+		{"GET", "/users/7/posts", "list posts of 7"},
+		{"DELETE", "/users/7/posts/3", "delete post 7/3"},
+	}
+	for _, tt := range tests {
+		trace = trace[:0]
+		w := performRequest(router, tt.method, tt.path)
+		if w.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %q", tt.method, tt.path, w.Code, w.Body.String(), tt.body)
+		}
+		if want := tt.method == "POST"; (len(trace) == 1) != want {
+			t.Errorf("%s %s: action middleware trace %v", tt.method, tt.path, trace)
+		}
+	}
+
+	// 没有实现的操作
+	if w := performRequest(router, "PUT", "/users/7"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /users/7: got %d, want 405", w.Code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("middlewares for unknown action should panic")
+		}
+	}()
+	router.Resource("/items", postResource{}, ResourceOptions{
+		Middlewares: map[string][]HandlerFunc{"Update": {}},
+	})
+}
+
+func TestStaticFS(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":      {Data: []byte("home")},
+		"css/app.css":     {Data: []byte("body{}")},
+		"docs/index.html": {Data: []byte("docs")},
+		"empty/a.txt":     {Data: []byte("a")},
+	}
+	router := New()
+	router.StaticFS("/assets", files, false)
+	router.StaticFS("/browse", files, true)
+	router.GET("/page", func(c *Context) { c.FileFromFS("docs", files) })
+	router.GET("/missing", func(c *Context) { c.FileFromFS("nothing.html", files) })
+
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/assets/css/app.css", "body{}", http.StatusOK},
+		{"/assets/", "home", http.StatusOK},
+		{"/assets/docs/", "docs", http.StatusOK},
+		{"/assets/nothing.js", "", http.StatusNotFound},
+		// 不列出目录
+		{"/assets/empty/", "", http.StatusNotFound},
+		{"/browse/empty/", "a.txt", http.StatusOK},
+		{"/page", "docs", http.StatusOK},
+		{"/missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("GET %s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestStaticOptions(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":       {Data: []byte("home")},
+		"app.3f2a9c.js":    {Data: []byte("console.log(1)")},
+		"app.3f2a9c.js.br": {Data: []byte("br-data")},
+		"app.3f2a9c.js.gz": {Data: []byte("gz-data")},
+		"css/site.css":     {Data: []byte("body{}")},
+		"docs/index.html":  {Data: []byte("docs")},
+		"docs/guide/a.txt": {Data: []byte("a")},
+	}
+	router := New()
+	router.StaticFS("/assets", files, false, StaticOptions{
+		ETag: true,
+		CacheControl: []CacheControlRule{
+			{Pattern: "*.[0-9a-f]*.js", Value: "public, max-age=31536000, immutable"},
+			{Pattern: "index.html", Value: "no-cache"},
+			{Pattern: "docs/*/*", Value: "max-age=60"},
+		},
+		Precompressed: true,
+	})
+
+	request := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/assets/", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "home" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("index: got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Errorf("expected strong etag, got %q", etag)
+	}
+	if w = request("/assets/", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: got %d %q", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		accept, body, encoding string
+	}{
+		{"gzip, deflate, br", "br-data", "br"},
+		{"gzip, br;q=0", "gz-data", "gzip"},
+		{"", "console.log(1)", ""},
+	}
+	for _, tt := range tests {
+		w = request("/assets/app.3f2a9c.js", map[string]string{"Accept-Encoding": tt.accept})
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("Accept-Encoding %q: got %q %q", tt.accept, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if ctype := w.Header().Get("Content-Type"); !strings.Contains(ctype, "javascript") {
+			t.Errorf("Accept-Encoding %q: content type %q", tt.accept, ctype)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" || !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+			t.Errorf("Accept-Encoding %q: header %v", tt.accept, w.Header())
+		}
+	}
+
+	if w = request("/assets/docs/guide/a.txt", nil); w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Errorf("path rule: got %v", w.Header())
+	}
+	if w = request("/assets/css/site.css", nil); w.Header().Get("Cache-Control") != "" {
+		t.Errorf("no rule: got %v", w.Header())
+	}
+	if w = request("/assets/docs", nil); w.Code != http.StatusMovedPermanently {
+		t.Errorf("directory redirect: got %d", w.Code)
+	}
+	if w = request("/assets/missing.js", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing: got %d", w.Code)
+	}
+}
+
+func TestStaticFallback(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":   {Data: []byte("app")},
+		"main.js":      {Data: []byte("js")},
+		"about/a.html": {Data: []byte("a")},
+	}
+	router := New()
+	router.GET("/api/users", func(c *Context) { c.String(http.StatusOK, "users") })
+	router.StaticFS("/", files, false, StaticOptions{
+		Fallback:        "index.html",
+		FallbackExclude: []string{"/api"},
+	})
+
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/", "app", http.StatusOK},
+		{"/main.js", "js", http.StatusOK},
+		{"/settings", "app", http.StatusOK},
+		{"/users/42/profile", "app", http.StatusOK},
+		{"/about/", "app", http.StatusOK},
+		{"/missing.js", "", http.StatusNotFound},
+		{"/css/site.css", "", http.StatusNotFound},
+		{"/api/users", "users", http.StatusOK},
+		{"/api/orders", "", http.StatusNotFound},
+		{"/api", "", http.StatusNotFound},
+		{"/apidocs", "app", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != tt.code || tt.code == http.StatusOK && w.Body.String() != tt.body {
+			t.Errorf("GET %s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(file, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	router := New()
+	router.GET("/file", func(c *Context) { c.File(file) })
+	router.GET("/dir", func(c *Context) { c.File(dir) })
+	router.GET("/download", func(c *Context) { c.FileAttachment(file, c.Query("name")) })
+	router.GET("/missing", func(c *Context) { c.FileAttachment(filepath.Join(dir, "none"), "") })
+
+	request := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/file", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("GET /file: got %d %q", w.Code, w.Body.String())
+	}
+	lastModified := w.Header().Get("Last-Modified")
+	if w = request("/file", map[string]string{"Range": "bytes=2-4"}); w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("Range: got %d %q", w.Code, w.Body.String())
+	}
+	if w = request("/file", map[string]string{"If-Modified-Since": lastModified}); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: got %d", w.Code)
+	}
+	w = request("/file", map[string]string{"Range": "bytes=2-4", "If-Range": "Mon, 02 Jan 2006 15:04:05 GMT"})
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("stale If-Range: got %d %q", w.Code, w.Body.String())
+	}
+	if w = request("/dir", nil); w.Code != http.StatusNotFound {
+		t.Errorf("directory: got %d", w.Code)
+	}
+
+	tests := []struct {
+		name, disposition string
+	}{
+		{"", `attachment; filename="report.txt"`},
+		{"a%22b.txt", `attachment; filename="a\"b.txt"`},
+		{"%E6%8A%A5%E5%91%8A+2024.txt", `attachment; filename="__ 2024.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202024.txt`},
+	}
+	for _, tt := range tests {
+		w = request("/download?name="+tt.name, nil)
+		if got := w.Header().Get("Content-Disposition"); w.Code != http.StatusOK || got != tt.disposition {
+			t.Errorf("name %q: got %d %q, want %q", tt.name, w.Code, got, tt.disposition)
+		}
+	}
+	if w = request("/missing", nil); w.Code != http.StatusNotFound || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("missing: got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	var status, size, legacy int
+	router := New()
+	router.Use(func(c *Context) {
+		c.Next()
+		status, size, legacy = c.Writer.Status(), c.Writer.Size(), c.StatusCode
+	})
+	router.GET("/raw", func(c *Context) {
+		if c.Writer.Written() || c.Writer.Size() != -1 {
+			t.Errorf("unexpected written state before write")
+		}
+		c.Writer.Write([]byte("hello"))
+	})
+	router.GET("/override", func(c *Context) {
+		c.Status(http.StatusCreated)
+		c.Status(http.StatusAccepted)
+		c.Writer.WriteString("ok")
+		c.Status(http.StatusTeapot)
+	})
+	router.GET("/empty", func(c *Context) { c.Status(http.StatusNoContent) })
+	router.GET("/flush", func(c *Context) {
+		c.Writer.Flush()
+		if !c.Writer.Written() || c.Writer.Pusher() != nil {
+			t.Errorf("unexpected state after flush")
+		}
+		if err := c.Writer.Push("/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("push without HTTP/2: got %v", err)
+		}
+		if _, _, err := c.Writer.Hijack(); err == nil {
+			t.Errorf("expected hijack error")
+		}
+	})
+
+	tests := []struct {
+		path       string
+		code, size int
+		flushed    bool
+	}{
+		{"/raw", http.StatusOK, 5, false},
+		{"/override", http.StatusAccepted, 2, false},
+		{"/empty", http.StatusNoContent, -1, false},
+		{"/flush", http.StatusOK, 0, true},
+	}
+	for _, tt := range tests {
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != tt.code || status != tt.code || size != tt.size || w.Flushed != tt.flushed {
+			t.Errorf("GET %s: got %d (logged %d, size %d, flushed %v), want %d (size %d)", tt.path, w.Code, status, size, w.Flushed, tt.code, tt.size)
+		}
+	}
+
+	// 兼容旧代码的StatusCode字段，只记录设置过的状态码
+	for path, want := range map[string]int{"/raw": 0, "/override": http.StatusAccepted, "/empty": http.StatusNoContent} {
+		if performRequest(router, "GET", path); legacy != want {
+			t.Errorf("GET %s: got StatusCode %d, want %d", path, legacy, want)
+		}
+	}
+}
+
+func TestContextErrors(t *testing.T) {
+	var recorded []string
+	var logged int
+	router := New()
+	// 类似Logger的全局中间件，能看到ErrorHandler设置的状态码
+	router.Use(func(c *Context) {
+		c.Next()
+		logged = c.Writer.Status()
+	})
+	router.Use(Recovery())
+	router.ErrorHandler = func(c *Context) {
+		if c.Path == "/panic" {
+			panic("error handler failed")
+		}
+		recorded = c.Errors.Errors()
+		if c.Writer.Written() {
+			return
+		}
+		public := c.Errors.ByType(ErrorTypePublic)
+		if len(public) == 0 {
+			c.String(http.StatusInternalServerError, "internal error")
+			return
+		}
+		c.JSON(http.StatusBadRequest, public.JSON())
+	}
+	router.GET("/public", func(c *Context) {
+		c.Error(errors.New("db timeout"))
+		c.Error(errors.New("name is required")).SetType(ErrorTypePublic).SetMeta(H{"field": "name"})
+	})
+	router.GET("/private", func(c *Context) {
+		c.Error(errors.New("db timeout"))
+	})
+	router.GET("/written", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+		c.Error(errors.New("after write"))
+	})
+	router.GET("/ok", func(c *Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/panic", func(c *Context) {
+		c.Error(errors.New("db timeout"))
+	})
+	router.NoRoute(func(c *Context) {
+		c.Error(errors.New("no route"))
+	})
+
+	tests := []struct {
+		path, body string
+		code       int
+		errors     int
+	}{
+		{"/public", `{"error":"name is required","field":"name"}`, http.StatusBadRequest, 2},
+		{"/private", "internal error", http.StatusInternalServerError, 1},
+		{"/written", "ok", http.StatusOK, 1},
+		{"/ok", "ok", http.StatusOK, 0},
+		// 没有匹配到路由时同样调用ErrorHandler
+		{"/missing", "internal error", http.StatusInternalServerError, 1},
+	}
+	for _, tt := range tests {
+		recorded, logged = nil, 0
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != tt.code || strings.TrimSpace(w.Body.String()) != tt.body || len(recorded) != tt.errors {
+			t.Errorf("GET %s: got %d %q %v, want %d %q", tt.path, w.Code, w.Body.String(), recorded, tt.code, tt.body)
+		}
+		if logged != tt.code {
+			t.Errorf("GET %s: middleware saw status %d, want %d", tt.path, logged, tt.code)
+		}
+	}
+
+	// ErrorHandler中的panic由Recovery处理
+	if w := performRequest(router, "GET", "/panic"); w.Code != http.StatusInternalServerError || logged != http.StatusInternalServerError {
+		t.Errorf("panic in ErrorHandler: got %d, logged %d", w.Code, logged)
+	}
+
+	e := &Error{Err: errors.New("bad"), Type: ErrorTypeBind | ErrorTypePublic}
+	if !e.IsType(ErrorTypePublic) || e.IsType(ErrorTypeRender) || !errors.Is(e, e.Err) {
+		t.Errorf("unexpected error type checks")
+	}
+	var msgs errorMsgs
+	if msgs.Last() != nil || msgs.JSON() != nil {
+		t.Errorf("expected empty errors")
+	}
+	msgs = errorMsgs{e, {Err: errors.New("worse"), Type: ErrorTypePrivate}}
+	if msgs.Last().Error() != "worse" || len(msgs.ByType(ErrorTypeBind)) != 1 || len(msgs.JSON().([]interface{})) != 2 {
+		t.Errorf("unexpected errors %v", msgs)
+	}
+}
+
+func TestErrorRenderer(t *testing.T) {
+	type signup struct {
+		User     string `json:"user" validate:"required"`
+		Password string `json:"password" validate:"required,min=6"`
+	}
+	setup := func(renderer ErrorRenderer) *Engine {
+		router := New()
+		router.ErrorRenderer = renderer
+		router.Use(Recovery())
+		router.POST("/signup", func(c *Context) {
+			var form signup
+			if c.Bind(&form) != nil {
+				return
+			}
+			c.String(http.StatusOK, "ok")
+		})
+		router.GET("/panic", func(c *Context) { panic("boom") })
+		assets := fstest.MapFS{"app.js": {Data: []byte("app")}}
+		router.StaticFS("/assets", assets, false)
+		router.StaticFS("/cached", assets, false, StaticOptions{ETag: true})
+		return router
+	}
+	request := func(router *Engine, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 默认保持原来的文本格式
+	router := setup(nil)
+	if w := request(router, "GET", "/nothing", ""); w.Code != http.StatusNotFound || w.Body.String() != "404 NOT FOUND: /nothing\n" {
+		t.Errorf("text 404: got %d %q", w.Code, w.Body.String())
+	}
+	if w := request(router, "GET", "/panic", ""); w.Code != http.StatusInternalServerError || w.Body.String() != "Internal Server Error" {
+		t.Errorf("text panic: got %d %q", w.Code, w.Body.String())
+	}
+
+	router = setup(ProblemJSONRenderer)
+	type problem struct {
+		Type          string         `json:"type"`
+		Title         string         `json:"title"`
+		Status        int            `json:"status"`
+		Detail        string         `json:"detail"`
+		Instance      string         `json:"instance"`
+		InvalidParams []InvalidParam `json:"invalid-params"`
+	}
+	tests := []struct {
+		method, path, body string
+		code               int
+		params             []string
+	}{
+		{"POST", "/signup", `{"password":"123"}`, http.StatusBadRequest, []string{"user", "password"}},
+		{"POST", "/signup", `{"user":`, http.StatusBadRequest, nil},
+		{"GET", "/panic", "", http.StatusInternalServerError, nil},
+		{"GET", "/nothing", "", http.StatusNotFound, nil},
+		{"GET", "/signup", "", http.StatusMethodNotAllowed, nil},
+		// 静态文件不存在时同样使用ErrorRenderer
+		{"GET", "/assets/missing.js", "", http.StatusNotFound, nil},
+		{"GET", "/cached/missing.js", "", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		w := request(router, tt.method, tt.path, tt.body)
+		var p problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Errorf("%s %s: invalid body %q", tt.method, tt.path, w.Body.String())
+			continue
+		}
+		if w.Code != tt.code || w.Header().Get("Content-Type") != "application/problem+json" ||
+			p.Status != tt.code || p.Type != "about:blank" || p.Title != http.StatusText(tt.code) || p.Instance != tt.path {
+			t.Errorf("%s %s: got %d %v %+v", tt.method, tt.path, w.Code, w.Header(), p)
+		}
+		var names []string
+		for _, param := range p.InvalidParams {
+			if param.Reason == "" {
+				t.Errorf("%s %s: empty reason for %s", tt.method, tt.path, param.Name)
+			}
+			names = append(names, param.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.params, ",") {
+			t.Errorf("%s %s: invalid params %v, want %v", tt.method, tt.path, names, tt.params)
+		}
+	}
+
+	// 嵌套结构体、切片、form标签和嵌入结构体的参数名
+	type item struct {
+		SKU string `form:"sku" validate:"required"`
+	}
+	type base struct {
+		Token string `validate:"required"`
+	}
+	type order struct {
+		base
+		Address struct {
+			City string `json:"city,omitempty" validate:"required"`
+		} `json:"address"`
+		Items []*item `json:"items" validate:"dive"`
+	}
+	err := (&Context{}).validate(&order{Items: []*item{{SKU: "a"}, {}}})
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	var names []string
+	for _, param := range ve.Params {
+		names = append(names, param.Name)
+	}
+	if got := strings.Join(names, ","); got != "Token,address.city,items[1].sku" {
+		t.Errorf("nested params: got %s", got)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	var trace []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) { trace = append(trace, name) }
+	}
+	router := New()
+	router.ErrorHandler = func(c *Context) {
+		c.String(c.Writer.Status(), "error: %s", c.Errors.Last())
+	}
+	router.Use(func(c *Context) {
+		c.Next()
+		trace = append(trace, "aborted="+strconv.FormatBool(c.IsAborted()))
+	})
+	router.GET("/status", func(c *Context) { c.AbortWithStatus(http.StatusUnauthorized) }, mark("handler"))
+	router.GET("/json", mark("a"), func(c *Context) {
+		c.AbortWithStatusJSON(http.StatusForbidden, H{"error": "forbidden"})
+	}, mark("handler"))
+	router.GET("/error", func(c *Context) {
+		c.Next()
+		mark("after")(c)
+	}, func(c *Context) {
+		c.AbortWithError(http.StatusBadGateway, errors.New("upstream"))
+	}, mark("handler"))
+	router.GET("/abort-next", func(c *Context) {
+		c.Abort()
+		c.Next()
+	}, mark("handler"))
+	router.GET("/ok", mark("handler"))
+
+	tests := []struct {
+		path, body, trace string
+		code              int
+	}{
+		{"/status", "", "aborted=true", http.StatusUnauthorized},
+		{"/json", `{"error":"forbidden"}`, "a,aborted=true", http.StatusForbidden},
+		{"/error", "error: upstream", "after,aborted=true", http.StatusBadGateway},
+		{"/abort-next", "", "aborted=true", http.StatusOK},
+		{"/ok", "", "handler,aborted=false", http.StatusOK},
+	}
+	for _, tt := range tests {
+		trace = nil
+		w := performRequest(router, "GET", tt.path)
+		if w.Code != tt.code || strings.TrimSpace(w.Body.String()) != tt.body || strings.Join(trace, ",") != tt.trace {
+			t.Errorf("GET %s: got %d %q %v, want %d %q %s", tt.path, w.Code, w.Body.String(), trace, tt.code, tt.body, tt.trace)
+		}
+	}
+}
+
+func TestCookies(t *testing.T) {
+	router := New()
+	router.CookieKeys = [][]byte{[]byte("new-key"), []byte("old-key")}
+	router.CookieEncryptionKeys = [][]byte{[]byte("0123456789abcdef0123456789abcdef")}
+	router.GET("/set", func(c *Context) {
+		c.SetCookie("lang", "zh CN;", CookieOptions{
+			MaxAge:      3600,
+			Secure:      true,
+			HttpOnly:    true,
+			SameSite:    http.SameSiteNoneMode,
+			Partitioned: true,
+		})
+		c.SetSignedCookie("uid", "42")
+		c.SetEncryptedCookie("token", "secret")
+		c.DeleteCookie("old", CookieOptions{Path: "/app"})
+	})
+	router.GET("/get", func(c *Context) {
+		lang, _ := c.Cookie("lang")
+		uid, err1 := c.SignedCookie("uid")
+		token, err2 := c.EncryptedCookie("token")
+		_, err3 := c.Cookie("missing")
+		c.String(http.StatusOK, "%s|%s|%v|%s|%v|%v", lang, uid, err1, token, err2, err3 == http.ErrNoCookie)
+	})
+
+	w := performRequest(router, "GET", "/set")
+	cookies := w.Header()["Set-Cookie"]
+	if len(cookies) != 4 {
+		t.Fatalf("expected 4 cookies, got %v", cookies)
+	}
+	for _, want := range []string{"Max-Age=3600", "HttpOnly", "Secure", "SameSite=None", "Partitioned", "Path=/"} {
+		if !strings.Contains(cookies[0], want) {
+			t.Errorf("cookie %q missing %s", cookies[0], want)
+		}
+	}
+	if !strings.HasPrefix(cookies[3], "old=; Path=/app;") || !strings.Contains(cookies[3], "Max-Age=0") {
+		t.Errorf("unexpected delete cookie %q", cookies[3])
+	}
+	if strings.Contains(cookies[2], "secret") {
+		t.Errorf("encrypted cookie is readable: %q", cookies[2])
+	}
+
+	get := func(cookies []string) string {
+		req := httptest.NewRequest("GET", "/get", nil)
+		for _, cookie := range cookies {
+			req.Header.Add("Cookie", cookie[:strings.IndexByte(cookie, ';')])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := get(cookies[:3]); body != "zh CN;|42|<nil>|secret|<nil>|true" {
+		t.Errorf("got %q", body)
+	}
+
+	// 轮换后旧密钥签名的Cookie仍然有效，篡改后无效
+	uid, token := cookies[1], cookies[2]
+	router.CookieKeys = [][]byte{[]byte("newer-key"), []byte("new-key")}
+	if body := get([]string{uid, token}); !strings.HasPrefix(body, "|42|<nil>|secret|") {
+		t.Errorf("rotated key: got %q", body)
+	}
+	tampered := strings.Replace(uid, "uid=", "uid=x", 1)
+	if body := get([]string{tampered, "token=abc;"}); body != "||"+ErrInvalidCookie.Error()+"||"+ErrInvalidCookie.Error()+"|true" {
+		t.Errorf("tampered: got %q", body)
+	}
+	router.CookieKeys = [][]byte{[]byte("other")}
+	if body := get([]string{uid}); !strings.Contains(body, ErrInvalidCookie.Error()) {
+		t.Errorf("unknown key: got %q", body)
+	}
+}
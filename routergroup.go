@@ -1,7 +1,10 @@
 package see
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"path"
 	"reflect"
 	"runtime"
@@ -18,49 +21,102 @@ type routerGroup struct {
 	prefix      string        // 路由分组Url
 	middlewares []HandlerFunc // 中间件
 	engine      *Engine
-	private     bool // 单个路由私有的分组，支持单路由中间件
+	parent      *routerGroup // 上一级分组，Engine自身的分组为nil
+	host        string       // Engine.Host返回的分组注册到对应域名的路由表
+	version     string       // 分组下的路由只匹配该API版本，见Version
 }
 
 func (this *routerGroup) Group(prefix string) *routerGroup {
-	engine := this.engine
-	newGroup := &routerGroup{
-		prefix: this.prefix + prefix, // 上一个路由分组前缀加下一个
-		engine: engine,
+	return &routerGroup{
+		prefix:  this.prefix + prefix, // 上一个路由分组前缀加下一个
+		engine:  this.engine,
+		parent:  this,
+		host:    this.host,
+		version: this.version,
 	}
-	engine.groups = append(engine.groups, newGroup)
-	return newGroup
 }
 
 // 中间件实现
 func (this *routerGroup) Use(middlewares ...HandlerFunc) {
-	this.middlewares = append(this.middlewares, middlewares...)
+	// 已经预编译过的中间件链会在新的路由表上重新生成
+	this.engine.modify(func(t *routeTable) {
+		this.middlewares = append(this.middlewares, middlewares...)
+	})
+}
+
+// 注册路由，除最后一个外都是单路由中间件
+func (this *routerGroup) addRoute(method string, pattern string, handler []HandlerFunc) *Route {
+	return this.register(method, pattern, handler, false)
 }
 
-// 注册路由
-func (this *routerGroup) addRoute(method string, pattern string, handler []HandlerFunc) {
+// mount为true时才能使用allMethods，只有Mount注册这种路由
+func (this *routerGroup) register(method string, pattern string, handler []HandlerFunc, mount bool) *Route {
 	l := len(handler)
 	lastHandler := handler[l-1]
-	// 处理单路由中间件
-	if l > 1 {
-		engine := this.engine
-		engine.groups = append(
-			engine.groups,
-			&routerGroup{
-				prefix:      this.prefix + pattern, // 上一个路由分组前缀加下一个
-				engine:      engine,
-				private:     true,
-				middlewares: handler[:l-1],
-			},
-		)
-	}
-	printRoute(method, this.prefix+pattern, lastHandler)
+	absolutePath := this.prefix + pattern
+	printRoute(method, this.host+absolutePath, lastHandler)
+
+	methods := []string{method}
 	if method == "Any" {
-		for _, method = range anyMethods {
-			this.engine.router.addRoute(method, this.prefix+pattern, lastHandler)
+		methods = anyMethods
+	}
+	engine := this.engine
+	source := callerSource()
+	r := &Route{engine: engine, entries: make([]*routeEntry, 0, len(methods))}
+	engine.modify(func(t *routeTable) {
+		router := t.lookup(this.host)
+		entries := make([]*routeEntry, len(methods))
+		for i := range methods {
+			entries[i] = &routeEntry{
+				path:        absolutePath,
+				group:       this,
+				version:     this.version,
+				middlewares: handler[:l-1],
+				source:      source,
+			}
+		}
+		// 先检查所有请求方式，任何一个失败时都不注册，避免Any只注册了一部分
+		failed := false
+		for i, method := range methods {
+			var err error
+			if method == allMethods && !mount {
+				err = errors.New("invalid http method '" + method + "'")
+			} else {
+				err = router.checkRoute(method, absolutePath, entries[i])
+			}
+			if err != nil {
+				engine.routeError(this.host, method, entries[i], err)
+				failed = true
+			}
+		}
+		if failed {
+			return
 		}
-		return
+		for i, method := range methods {
+			if err := router.addRoute(method, absolutePath, lastHandler, entries[i]); err != nil {
+				engine.routeError(this.host, method, entries[i], err)
+				continue
+			}
+			r.entries = append(r.entries, entries[i])
+		}
+	})
+	return r
+}
+
+// 中间件只由注册路由的分组决定：从最上级分组开始依次合并各级分组的中间件，
+// 最后加上单路由中间件，与请求路径的字符串前缀无关
+func (this *routerGroup) combineHandlers(middlewares []HandlerFunc) []HandlerFunc {
+	var handlers []HandlerFunc
+	if this.parent != nil {
+		handlers = this.parent.combineHandlers(nil)
 	}
-	this.engine.router.addRoute(method, this.prefix+pattern, lastHandler)
+	handlers = append(handlers, this.middlewares...)
+	if this.parent == nil && this.engine.ErrorHandler != nil {
+		// ErrorHandler紧跟在全局中间件之后
+		handlers = append(handlers, this.engine.handleErrors)
+	}
+	handlers = append(handlers, middlewares...)
+	return handlers[:len(handlers):len(handlers)]
 }
 
 func printRoute(httpMethod, absolutePath string, handler HandlerFunc) {
@@ -69,45 +125,109 @@ func printRoute(httpMethod, absolutePath string, handler HandlerFunc) {
 			access.PrintRoute(httpMethod, absolutePath)
 		}
 	} else {
-		handlerName := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
-		DebugPrintRouteFunc(httpMethod, absolutePath, handlerName)
+		DebugPrintRouteFunc(httpMethod, absolutePath, nameOfFunction(handler))
 	}
 }
 
-func (this *routerGroup) Handle(method, pattern string, handler ...HandlerFunc) {
-	this.addRoute(method, pattern, handler)
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+func (this *routerGroup) Handle(method, pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute(method, pattern, handler)
 }
 
-func (this *routerGroup) Any(pattern string, handler ...HandlerFunc) {
-	this.addRoute("Any", pattern, handler)
+func (this *routerGroup) Any(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("Any", pattern, handler)
 }
 
-func (this *routerGroup) GET(pattern string, handler ...HandlerFunc) {
-	this.addRoute("GET", pattern, handler)
+func (this *routerGroup) GET(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("GET", pattern, handler)
 }
 
-func (this *routerGroup) POST(pattern string, handler ...HandlerFunc) {
-	this.addRoute("POST", pattern, handler)
+func (this *routerGroup) POST(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("POST", pattern, handler)
 }
 
-func (this *routerGroup) PUT(pattern string, handler ...HandlerFunc) {
-	this.addRoute("PUT", pattern, handler)
+func (this *routerGroup) PUT(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("PUT", pattern, handler)
 }
 
-func (this *routerGroup) DELETE(pattern string, handler ...HandlerFunc) {
-	this.addRoute("DELETE", pattern, handler)
+func (this *routerGroup) DELETE(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("DELETE", pattern, handler)
 }
 
-func (this *routerGroup) PATCH(pattern string, handler ...HandlerFunc) {
-	this.addRoute("PATCH", pattern, handler)
+func (this *routerGroup) PATCH(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("PATCH", pattern, handler)
 }
 
-func (this *routerGroup) HEAD(pattern string, handler ...HandlerFunc) {
-	this.addRoute("HEAD", pattern, handler)
+func (this *routerGroup) HEAD(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("HEAD", pattern, handler)
 }
 
-func (this *routerGroup) OPTIONS(pattern string, handler ...HandlerFunc) {
-	this.addRoute("OPTIONS", pattern, handler)
+func (this *routerGroup) OPTIONS(pattern string, handler ...HandlerFunc) *Route {
+	return this.addRoute("OPTIONS", pattern, handler)
+}
+
+// 把http.Handler挂载到prefix下，prefix和它下面的所有路径都交给h处理，
+// 包括PROPFIND等自定义请求方式在内的所有请求方式都会转发，同一路径单独注册的
+// 请求方式优先。请求路径会去掉prefix再传给h，分组中间件照常执行，
+// 也可以挂载另一个*Engine
+//
+// router.Mount("/debug/pprof", http.DefaultServeMux)
+// router.Group("/admin", auth).Mount("/ui", adminEngine)
+func (this *routerGroup) Mount(prefix string, h http.Handler, middlewares ...HandlerFunc) {
+	if strings.Contains(prefix, "*") {
+		panic("catch-all routes are not allowed in mount prefix '" + prefix + "'")
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := append(middlewares[:len(middlewares):len(middlewares)], mountHandler(h))
+	if prefix != "" {
+		this.register(allMethods, prefix, handler, true)
+	}
+	this.register(allMethods, prefix+"/*"+mountParam, handler, true)
+}
+
+// Mount注册的catchAll参数名
+const mountParam = "mountpath"
+
+func mountHandler(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		rest := c.Param(mountParam)
+		if rest == "" {
+			rest = "/"
+		}
+		// 实际匹配到的前缀，可能包含参数
+		matched := strings.TrimSuffix(c.Req.URL.Path, rest)
+
+		r := new(http.Request)
+		*r = *c.Req
+		r.URL = new(url.URL)
+		*r.URL = *c.Req.URL
+		r.URL.Path = rest
+		if r.URL.RawPath != "" {
+			if raw := strings.TrimPrefix(r.URL.RawPath, matched); raw != r.URL.RawPath {
+				r.URL.RawPath = raw
+			} else {
+				r.URL.RawPath = ""
+			}
+		}
+		h.ServeHTTP(c.Writer, r)
+	}
+}
+
+// 把http.HandlerFunc转换为HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// 把http.Handler转换为HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
 }
 
 // 静态文件实现
@@ -123,34 +243,82 @@ func (this *routerGroup) StaticFile(relativePath, filepath string) {
 	this.HEAD(relativePath, handler)
 }
 
-func (this *routerGroup) Static(relativePath string, root string) {
+// 静态文件实现，可以传入StaticOptions设置ETag、Cache-Control和预压缩文件
+func (this *routerGroup) Static(relativePath string, root string, opts ...StaticOptions) {
 	// 动态参数不能在静态文件系统里使用
 	if strings.Contains(relativePath, ":") || strings.Contains(relativePath, "*") {
 		panic("Dynamic parameters cannot be used when serving static files")
 	}
 
-	handler := this.createStaticHandler(relativePath, http.Dir(root))
+	handler := this.createStaticHandler(relativePath, http.Dir(root), opts)
 	urlPattern := path.Join(relativePath, "/*filepath")
 	// 注册方法
 	this.GET(urlPattern, handler)
 	this.HEAD(urlPattern, handler)
 }
 
-func (this *routerGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
+// 静态文件实现，文件来自fs.FS，如embed.FS。listDirectory为false时，
+// 没有index.html的目录和不存在的文件一样返回404
+func (this *routerGroup) StaticFS(relativePath string, fsys fs.FS, listDirectory bool, opts ...StaticOptions) {
+	if strings.Contains(relativePath, ":") || strings.Contains(relativePath, "*") {
+		panic("Dynamic parameters cannot be used when serving static files")
+	}
+
+	var fileSystem http.FileSystem = http.FS(fsys)
+	if !listDirectory {
+		fileSystem = noListingFS{fileSystem}
+	}
+	handler := this.createStaticHandler(relativePath, fileSystem, opts)
+	urlPattern := path.Join(relativePath, "/*filepath")
+	this.GET(urlPattern, handler)
+	this.HEAD(urlPattern, handler)
+}
+
+func (this *routerGroup) createStaticHandler(relativePath string, fs http.FileSystem, opts []StaticOptions) HandlerFunc {
 	absolutePath := path.Join(this.prefix, relativePath)
 	fileServer := http.StripPrefix(absolutePath, http.FileServer(fs))
+	if len(opts) > 0 {
+		return newStaticServer(fs, fileServer, opts[0]).handle
+	}
 	return func(c *Context) {
-		file := c.Param("filepath")
+		file := path.Clean(c.Param("filepath"))
 		// 检查文件是否有权限打开
-		if _, err := fs.Open(file); err != nil {
-			c.Status(http.StatusNotFound)
+		f, err := fs.Open(file)
+		if err != nil {
+			staticNotFound(c)
 			return
 		}
-		c.StatusCode = http.StatusOK
+		f.Close()
 		fileServer.ServeHTTP(c.Writer, c.Req)
 	}
 }
 
+// 不列出目录内容的文件系统，目录下没有index.html时当作不存在
+type noListingFS struct {
+	http.FileSystem
+}
+
+func (this noListingFS) Open(name string) (http.File, error) {
+	f, err := this.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		index, err := this.FileSystem.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, fs.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
 type RESTful interface {
 	Create(*Context)
 	Query(*Context)
@@ -6,8 +6,8 @@ import (
 	"github.com/cloudwego/netpoll-http2"
 	"net"
 	"net/http"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,23 +42,72 @@ type HandlerFunc func(c *Context)
 type Engine struct {
 	// Engine继承routerGroup所有属性和方法
 	*routerGroup
-	router *route
-	groups []*routerGroup
+	// 当前的路由表*routeTable，处理请求时原子地读取，不需要加锁
+	table atomic.Value
+	// 修改路由表时加锁，同一时间只有一个修改
+	mu sync.Mutex
+
+	// 请求的路径只有末尾斜杠与注册的路由不同时自动重定向，
+	// 如只注册了 /foo 时 /foo/ 会重定向到 /foo，反之亦然
+	RedirectTrailingSlash bool
+
+	// 没有匹配到路由时，清理路径中多余的 ../ 和 //，并忽略大小写重新查找，
+	// 找到则重定向到注册的路径，如 /FOO 和 /..//Foo 会重定向到 /foo
+	RedirectFixedPath bool
+
+	// 路径存在但请求方式不匹配时返回405，并在Allow头中列出允许的请求方式，
+	// 可以通过NoMethod自定义响应
+	HandleMethodNotAllowed bool
+
+	// 没有注册OPTIONS路由时，根据该路径已注册的请求方式自动响应OPTIONS请求
+	HandleOPTIONS bool
+
+	// 请求中指定API版本的头，见routerGroup.Version，默认为 X-API-Version
+	VersionHeader string
+	// 请求中没有指定API版本时使用的版本，为空时只匹配没有指定版本的路由
+	DefaultVersion string
+
+	// 注册路由失败时不panic，记录下来并跳过该路由，
+	// 注册完成后通过ValidateRoutes一次性获取所有错误
+	CollectRouteErrors bool
+	routeErrors        RouteErrors
+
+	// 请求处理完成后c.Errors不为空时调用，统一把记录的错误转换为响应，
+	// 处理之前通常需要检查c.Writer.Written()。作为中间件排在Use注册的全局中间件之后，
+	// Logger能记录它设置的状态码，Recovery能捕获其中的panic。需要在处理请求之前设置
+	ErrorHandler HandlerFunc
+
+	// 框架生成的错误响应（参数绑定失败、panic、404、405和406）的输出方式，
+	// 默认为TextErrorRenderer，可以设置为ProblemJSONRenderer
+	ErrorRenderer ErrorRenderer
+
+	// 签名Cookie的HMAC密钥，第一个用于签名，校验时依次尝试，便于轮换密钥
+	CookieKeys [][]byte
+	// 加密Cookie的AES密钥（16、24或32字节），第一个用于加密，解密时依次尝试
+	CookieEncryptionKeys [][]byte
 
 	// Value of 'maxMemory' param that is given to http.Request's ParseMultipartForm method call.
 	MaxMultipartMemory int64
 	// context的临时对象池
 	pool sync.Pool
 
+	// 中间件链是否已经预编译
+	freeze sync.Once
+	frozen bool
+
 	maxParams      uint8
 	maxMiddlewares uint8
 }
 
 func New(opt ...uint8) *Engine {
-	engine := &Engine{router: newRoute()}
+	engine := &Engine{}
+	engine.table.Store(newRouteTable())
 	engine.routerGroup = &routerGroup{engine: engine}
-	engine.groups = []*routerGroup{engine.routerGroup}
 	engine.MaxMultipartMemory = defaultMultipartMemory
+	engine.RedirectTrailingSlash = true
+	engine.HandleMethodNotAllowed = true
+	engine.HandleOPTIONS = true
+	engine.VersionHeader = "X-API-Version"
 	switch len(opt) {
 	case 1:
 		engine.maxParams = opt[0]
@@ -95,44 +144,76 @@ func Default() *Engine {
 }
 
 func (this *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 首次处理请求时预编译所有路由的中间件链
+	this.freeze.Do(this.compile)
+
 	// 取一个临时Context对象
 	c := this.pool.Get().(*Context)
 	c.SetContext(w, r)
 
-	// 找出所有路由的中间件函数
-	for _, group := range this.groups {
-		if strings.HasPrefix(r.URL.Path, group.prefix) {
-			if group.private == false || (group.private && (r.URL.Path == group.prefix)) {
-				//c.handlers = append(c.handlers, group.middlewares...)
-				for _, middle := range group.middlewares {
-					i := len(c.handlers)
-					c.handlers = (c.handlers)[:i+1]
-					(c.handlers)[i] = middle
-				}
-			}
-		} else {
-			fullpath := this.router.getRoute(r.Method, r.URL.Path, &c.Params, &c.lastHandler)
-			if strings.HasPrefix(fullpath, group.prefix) {
-				for _, middle := range group.middlewares {
-					i := len(c.handlers)
-					c.handlers = (c.handlers)[:i+1]
-					(c.handlers)[i] = middle
-				}
-			}
-		}
-	}
-
 	c.engine = this
-	this.router.handle(c)
+	t := this.table.Load().(*routeTable)
+	router := t.router
+	if len(t.hosts) > 0 {
+		router = t.hostRouter(c)
+	}
+	router.handle(c)
+	// 只设置了状态码没有写入响应体时，在这里写出响应头
+	c.Writer.WriteHeaderNow()
 
 	// 重置标记后放回对象池
 	c.Reset()
 	this.pool.Put(c)
 }
 
+// 在全局中间件之后执行，处理完成后c.Errors不为空时调用ErrorHandler
+func (this *Engine) handleErrors(c *Context) {
+	c.Next()
+	if len(c.Errors) > 0 {
+		this.ErrorHandler(c)
+	}
+}
+
+// 预编译所有路由的中间件链，存到radix树的叶子节点上，处理请求时只需查找一次路由。
+// 首次处理请求时会自动调用，之后注册路由和中间件会在新的路由表上重新预编译
+func (this *Engine) Freeze() {
+	this.freeze.Do(this.compile)
+}
+
+func (this *Engine) compile() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.table.Load().(*routeTable).compile(this)
+	this.frozen = true
+}
+
+// 返回所有已注册的路由，先是Engine自身的路由，再按Host分别列出，各自按路径排序
+func (this *Engine) Routes() RoutesInfo {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var routes RoutesInfo
+	for _, router := range this.table.Load().(*routeTable).routers() {
+		routes = append(routes, router.routes()...)
+	}
+	return routes
+}
+
 // 找不到路由时的回调
 func (this *Engine) NoRoute(handler HandlerFunc) {
-	this.router.noRoute = handler
+	this.modify(func(t *routeTable) {
+		for _, router := range t.routers() {
+			router.noRoute = handler
+		}
+	})
+}
+
+// 请求方式不匹配时的回调，调用前已设置好Allow头
+func (this *Engine) NoMethod(handler HandlerFunc) {
+	this.modify(func(t *routeTable) {
+		for _, router := range t.routers() {
+			router.noMethod = handler
+		}
+	})
 }
 
 func (this *Engine) Run(addr ...string) (err error) {
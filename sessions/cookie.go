@@ -0,0 +1,56 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/junbin-yang/see"
+)
+
+// 把会话数据签名后保存在Cookie中，签名使用Engine.CookieKeys，
+// 客户端可以看到但不能修改会话数据。Cookie最大约4KB，只适合保存少量数据，
+// 会话只能在写出响应头之前修改
+type CookieStore struct{}
+
+var _ Store = CookieStore{}
+
+type cookiePayload struct {
+	ID      string
+	Expires time.Time
+	Values  map[string]interface{}
+}
+
+func NewCookieStore() CookieStore {
+	return CookieStore{}
+}
+
+func (CookieStore) Load(c *see.Context, name string) (string, map[string]interface{}, error) {
+	value, err := c.SignedCookie(name)
+	if err != nil {
+		return "", nil, nil
+	}
+	var payload cookiePayload
+	if err := gob.NewDecoder(bytes.NewBufferString(value)).Decode(&payload); err != nil {
+		return "", nil, nil
+	}
+	if time.Now().After(payload.Expires) {
+		return "", nil, nil
+	}
+	return payload.ID, payload.Values, nil
+}
+
+func (CookieStore) Save(c *see.Context, name, id string, values map[string]interface{}, options Options) error {
+	payload := cookiePayload{ID: id, Expires: time.Now().Add(options.MaxAge), Values: values}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&payload); err != nil {
+		return err
+	}
+	c.SetSignedCookie(name, buf.String(), options.cookie())
+	return nil
+}
+
+// 数据都在Cookie中，没有需要删除的数据
+func (CookieStore) Delete(id string) error {
+	return nil
+}
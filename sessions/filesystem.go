@@ -0,0 +1,118 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/junbin-yang/see"
+)
+
+const filePrefix = "session_"
+
+// 每个会话保存为目录下的一个文件，可以在多个进程间共享。
+// 过期的文件在访问时删除，也可以定期调用GC清理
+type FileStore struct {
+	dir string
+}
+
+var _ Store = &FileStore{}
+
+type fileEntry struct {
+	Expires time.Time
+	Values  map[string]interface{}
+}
+
+// dir不存在时在第一次保存会话时创建
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Load(c *see.Context, name string) (string, map[string]interface{}, error) {
+	id := cookieID(c, name)
+	if id == "" {
+		return "", nil, nil
+	}
+	entry, err := s.read(s.path(id))
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if time.Now().After(entry.Expires) {
+		os.Remove(s.path(id))
+		return "", nil, nil
+	}
+	return id, entry.Values, nil
+}
+
+func (s *FileStore) Save(c *see.Context, name, id string, values map[string]interface{}, options Options) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，并发读取时不会读到写了一半的文件
+	f, err := ioutil.TempFile(s.dir, ".tmp-"+filePrefix)
+	if err != nil {
+		return err
+	}
+	entry := fileEntry{Expires: time.Now().Add(options.MaxAge), Values: values}
+	err = gob.NewEncoder(f).Encode(&entry)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(id))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	c.SetCookie(name, id, options.cookie())
+	return nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	if !validID(id) {
+		return nil
+	}
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 删除所有已过期的会话文件
+func (s *FileStore) GC() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, filePrefix+"*"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		entry, err := s.read(name)
+		if err != nil || now.After(entry.Expires) {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filePrefix+id)
+}
+
+func (s *FileStore) read(name string) (*fileEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entry fileEntry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,153 @@
+package sessions
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/junbin-yang/see"
+)
+
+// 内存中的会话存储，过期的会话在访问、保存新会话或调用GC时删除，
+// 超过数量上限时淘汰最久未使用的会话。
+// 进程重启后会话全部失效，只适合单实例部署
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List // 按最近使用排序，用于淘汰
+	expiry     expiryHeap // 按过期时间排序，用于删除过期的会话
+	items      map[string]*list.Element
+}
+
+type memoryEntry struct {
+	id      string
+	values  map[string]interface{}
+	expires time.Time
+	index   int // 在expiry中的下标
+}
+
+// 过期时间最早的会话在堆顶
+type expiryHeap []*memoryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*memoryEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+var _ Store = &MemoryStore{}
+
+// maxEntries为最多保存的会话数，0表示不限制
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Load(c *see.Context, name string) (string, map[string]interface{}, error) {
+	id := cookieID(c, name)
+	if id == "" {
+		return "", nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[id]
+	if !ok {
+		return "", nil, nil
+	}
+	entry := e.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		s.removeElement(e)
+		return "", nil, nil
+	}
+	s.ll.MoveToFront(e)
+	return id, copyValues(entry.values), nil
+}
+
+func (s *MemoryStore) Save(c *see.Context, name, id string, values map[string]interface{}, options Options) error {
+	now := time.Now()
+	values = copyValues(values)
+	s.mu.Lock()
+	if e, ok := s.items[id]; ok {
+		entry := e.Value.(*memoryEntry)
+		entry.values = values
+		entry.expires = now.Add(options.MaxAge)
+		heap.Fix(&s.expiry, entry.index)
+		s.ll.MoveToFront(e)
+	} else {
+		entry := &memoryEntry{id: id, values: values, expires: now.Add(options.MaxAge)}
+		s.items[id] = s.ll.PushFront(entry)
+		heap.Push(&s.expiry, entry)
+		// 删除已过期的会话，不再访问的会话不会一直占用内存
+		for len(s.expiry) > 0 && now.After(s.expiry[0].expires) {
+			s.removeElement(s.items[s.expiry[0].id])
+		}
+		for s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+			s.removeElement(s.ll.Back())
+		}
+	}
+	s.mu.Unlock()
+	c.SetCookie(name, id, options.cookie())
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[id]; ok {
+		s.removeElement(e)
+	}
+	return nil
+}
+
+// 删除所有已过期的会话
+func (s *MemoryStore) GC() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.expiry) > 0 && now.After(s.expiry[0].expires) {
+		s.removeElement(s.items[s.expiry[0].id])
+	}
+}
+
+// 返回当前保存的会话数，包括已过期但还没有删除的
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+func (s *MemoryStore) removeElement(e *list.Element) {
+	entry := e.Value.(*memoryEntry)
+	s.ll.Remove(e)
+	heap.Remove(&s.expiry, entry.index)
+	delete(s.items, entry.id)
+}
+
+// 会话数据在请求之间不共享，避免并发请求同时修改同一个map
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,276 @@
+// 服务端会话，会话数据保存在Store中，请求处理过程中通过Session(c)读写
+//
+//	store := sessions.NewMemoryStore(10000)
+//	router.Use(sessions.Sessions("sid", store))
+//	router.POST("/login", func(c *see.Context) {
+//		s := sessions.Session(c)
+//		s.Regenerate()
+//		s.Set("uid", 42)
+//		s.Flash("notice", "登录成功")
+//	})
+//
+// 会话数据使用encoding/gob编码（内存存储除外），自定义类型需要先调用gob.Register注册
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/junbin-yang/see"
+)
+
+// 保存在see.Context中的键
+const contextKey = "github.com/junbin-yang/see/sessions"
+
+// Flash消息在会话数据中的键前缀
+const flashPrefix = "_flash:"
+
+func init() {
+	// Flash消息保存为[]interface{}
+	gob.Register([]interface{}{})
+}
+
+// 会话数据的存储
+type Store interface {
+	// 返回请求携带的会话id和数据，没有有效的会话时id为空
+	Load(c *see.Context, name string) (id string, values map[string]interface{}, err error)
+	// 保存会话数据，并把会话写入名为name的Cookie
+	Save(c *see.Context, name, id string, values map[string]interface{}, options Options) error
+	// 删除id对应的会话数据，不修改Cookie
+	Delete(id string) error
+}
+
+// 会话的配置
+type Options struct {
+	// 会话Cookie的属性，其中的MaxAge由下面的MaxAge决定。
+	// 为nil时使用默认属性：Path为 /，HttpOnly，SameSite=Lax
+	Cookie *see.CookieOptions
+	// 会话的有效期，每次保存后重新计算，默认24小时
+	MaxAge time.Duration
+}
+
+var defaultCookie = see.CookieOptions{
+	Path:     "/",
+	HttpOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+const defaultMaxAge = 24 * time.Hour
+
+func (o Options) cookie() see.CookieOptions {
+	opt := defaultCookie
+	if o.Cookie != nil {
+		opt = *o.Cookie
+	}
+	opt.MaxAge = int(o.MaxAge / time.Second)
+	return opt
+}
+
+// 会话中间件，name为保存会话的Cookie名称。会话数据有修改时，
+// 在写出响应头之前自动保存
+func Sessions(name string, store Store, options ...Options) see.HandlerFunc {
+	var opt Options
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	if opt.MaxAge <= 0 {
+		opt.MaxAge = defaultMaxAge
+	}
+	return func(c *see.Context) {
+		s := &State{c: c, name: name, store: store, options: opt}
+		id, values, err := store.Load(c, name)
+		if err != nil {
+			c.Error(err)
+		}
+		if id != "" {
+			s.id, s.values = id, values
+		}
+		if s.values == nil {
+			s.values = map[string]interface{}{}
+		}
+		c.Set(contextKey, s)
+
+		w := &sessionWriter{ResponseWriter: c.Writer, state: s}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+			// 处理过程中panic时不保存修改了一半的会话，Recovery写出的响应不经过sessionWriter
+			if err := recover(); err != nil {
+				panic(err)
+			}
+			s.autoSave()
+		}()
+		c.Next()
+	}
+}
+
+// 返回当前请求的会话，没有使用Sessions中间件时panic
+func Session(c *see.Context) *State {
+	return c.MustGet(contextKey).(*State)
+}
+
+// 一次请求中的会话
+type State struct {
+	c       *see.Context
+	name    string
+	store   Store
+	options Options
+
+	id       string
+	oldID    string // Regenerate之前的id，保存时删除
+	values   map[string]interface{}
+	modified bool
+}
+
+// 返回会话id，新会话在第一次保存之前为空
+func (s *State) ID() string {
+	return s.id
+}
+
+func (s *State) Get(key string) interface{} {
+	return s.values[key]
+}
+
+func (s *State) Set(key string, value interface{}) {
+	s.values[key] = value
+	s.modified = true
+}
+
+func (s *State) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// 删除所有数据
+func (s *State) Clear() {
+	if len(s.values) > 0 {
+		s.values = map[string]interface{}{}
+		s.modified = true
+	}
+}
+
+// 添加一条只能读取一次的消息，通常在重定向之前设置，在下一个请求中通过Flashes读取
+func (s *State) Flash(key string, value interface{}) {
+	flashes, _ := s.values[flashPrefix+key].([]interface{})
+	// 复制后再追加，不修改存储中共享的切片
+	s.Set(flashPrefix+key, append(flashes[:len(flashes):len(flashes)], value))
+}
+
+// 返回并删除key下的所有Flash消息
+func (s *State) Flashes(key string) []interface{} {
+	flashes, _ := s.values[flashPrefix+key].([]interface{})
+	s.Delete(flashPrefix + key)
+	return flashes
+}
+
+// 更换会话id并保留数据，登录等权限变化后调用以防止会话固定攻击，
+// 旧id的数据在保存时删除
+func (s *State) Regenerate() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	if s.id != "" && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = id
+	s.modified = true
+	return nil
+}
+
+// 立即保存会话，没有修改时不做任何操作。中间件会自动保存，
+// 只有需要处理保存失败时才需要调用
+func (s *State) Save() error {
+	if !s.modified {
+		return nil
+	}
+	if s.id == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		s.id = id
+	}
+	if s.oldID != "" {
+		if err := s.store.Delete(s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+	if err := s.store.Save(s.c, s.name, s.id, s.values, s.options); err != nil {
+		return err
+	}
+	s.modified = false
+	return nil
+}
+
+func (s *State) autoSave() {
+	if err := s.Save(); err != nil {
+		s.c.Error(err)
+	}
+}
+
+// 32字节随机数，URL安全的base64编码
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 从Cookie中读取会话id，格式不正确时返回空字符串
+func cookieID(c *see.Context, name string) string {
+	id, err := c.Cookie(name)
+	if err != nil || !validID(id) {
+		return ""
+	}
+	return id
+}
+
+// 会话id由newID生成，检查格式后才能用作文件名
+func validID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") == ""
+}
+
+// 写出响应头之前保存会话，保证Cookie能写入响应
+type sessionWriter struct {
+	see.ResponseWriter
+	state *State
+}
+
+func (w *sessionWriter) beforeWrite() {
+	if !w.Written() {
+		w.state.autoSave()
+	}
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) Flush() {
+	w.beforeWrite()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,243 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junbin-yang/see"
+)
+
+// 保存上一次响应设置的Cookie，模拟浏览器
+type client struct {
+	router  http.Handler
+	cookies map[string]string
+}
+
+func (cl *client) get(path string) string {
+	req := httptest.NewRequest("GET", path, nil)
+	for name, value := range cl.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	w := httptest.NewRecorder()
+	cl.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(cl.cookies, cookie.Name)
+		} else {
+			cl.cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return w.Body.String()
+}
+
+func newRouter(store Store, options ...Options) *see.Engine {
+	router := see.New()
+	router.CookieKeys = [][]byte{[]byte("secret")}
+	router.Use(Sessions("sid", store, options...))
+	router.GET("/login", func(c *see.Context) {
+		s := Session(c)
+		if err := s.Regenerate(); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Set("uid", 42)
+		s.Flash("notice", "welcome")
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/me", func(c *see.Context) {
+		s := Session(c)
+		c.String(http.StatusOK, "%v %v", s.Get("uid"), s.Flashes("notice"))
+	})
+	router.GET("/logout", func(c *see.Context) {
+		Session(c).Clear()
+	})
+	router.GET("/id", func(c *see.Context) {
+		c.String(http.StatusOK, Session(c).ID())
+	})
+	return router
+}
+
+func testStore(t *testing.T, store Store) {
+	cl := &client{router: newRouter(store), cookies: map[string]string{}}
+	if body := cl.get("/me"); body != "<nil> []" {
+		t.Fatalf("anonymous: got %q", body)
+	}
+	if len(cl.cookies) != 0 {
+		t.Errorf("unmodified session should not set a cookie: %v", cl.cookies)
+	}
+
+	cl.get("/login")
+	first := cl.get("/id")
+	if body := cl.get("/me"); body != "42 [welcome]" {
+		t.Errorf("after login: got %q", body)
+	}
+	// Flash只能读取一次
+	if body := cl.get("/me"); body != "42 []" {
+		t.Errorf("flash read twice: got %q", body)
+	}
+
+	// 重新登录后id改变，旧id失效
+	old := cl.cookies["sid"]
+	cl.get("/login")
+	if second := cl.get("/id"); second == first || second == "" {
+		t.Errorf("expected a new session id, got %q and %q", first, second)
+	}
+	if _, ok := store.(CookieStore); !ok {
+		stale := &client{router: cl.router, cookies: map[string]string{"sid": old}}
+		if body := stale.get("/me"); body != "<nil> []" {
+			t.Errorf("old session id is still valid: %q", body)
+		}
+	}
+
+	cl.get("/logout")
+	if body := cl.get("/me"); body != "<nil> []" {
+		t.Errorf("after logout: got %q", body)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(0))
+
+	// 超过上限时淘汰最久未使用的会话
+	store := NewMemoryStore(2)
+	router := newRouter(store)
+	var clients []*client
+	for i := 0; i < 3; i++ {
+		cl := &client{router: router, cookies: map[string]string{}}
+		cl.get("/login")
+		clients = append(clients, cl)
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected 2 sessions, got %d", store.Len())
+	}
+	if body := clients[0].get("/me"); body != "<nil> []" {
+		t.Errorf("evicted session: got %q", body)
+	}
+	if body := clients[2].get("/me"); body != "42 [welcome]" {
+		t.Errorf("recent session: got %q", body)
+	}
+
+	// 过期的会话
+	store = NewMemoryStore(0)
+	router = newRouter(store, Options{MaxAge: time.Millisecond})
+	cl := &client{router: router, cookies: map[string]string{}}
+	cl.get("/login")
+	time.Sleep(5 * time.Millisecond)
+	if body := cl.get("/me"); body != "<nil> []" {
+		t.Errorf("expired session: got %q", body)
+	}
+
+	// 不再访问的过期会话在保存新会话或GC时删除
+	for i := 0; i < 2; i++ {
+		(&client{router: router, cookies: map[string]string{}}).get("/login")
+	}
+	time.Sleep(5 * time.Millisecond)
+	(&client{router: router, cookies: map[string]string{}}).get("/login")
+	if store.Len() != 1 {
+		t.Errorf("expired sessions kept after save: %d", store.Len())
+	}
+	time.Sleep(5 * time.Millisecond)
+	store.GC()
+	if store.Len() != 0 {
+		t.Errorf("expired sessions kept after GC: %d", store.Len())
+	}
+
+	// 读取过的会话排在最近使用的一端，过期后同样在保存新会话时删除
+	long := newRouter(store, Options{MaxAge: time.Hour})
+	short := &client{router: router, cookies: map[string]string{}}
+	short.get("/login")
+	(&client{router: long, cookies: map[string]string{}}).get("/login")
+	short.get("/id")
+	time.Sleep(5 * time.Millisecond)
+	(&client{router: long, cookies: map[string]string{}}).get("/login")
+	if store.Len() != 2 {
+		t.Errorf("expired session behind a live one: got %d sessions, want 2", store.Len())
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	testStore(t, NewCookieStore())
+
+	cl := &client{router: newRouter(NewCookieStore()), cookies: map[string]string{}}
+	cl.get("/login")
+	value := cl.cookies["sid"]
+	cl.cookies["sid"] = strings.Replace(value, value[:4], "AAAA", 1)
+	if body := cl.get("/me"); body != "<nil> []" {
+		t.Errorf("tampered cookie: got %q", body)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(t.TempDir()))
+
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store := NewFileStore(dir)
+	cl := &client{router: newRouter(store, Options{MaxAge: time.Millisecond}), cookies: map[string]string{}}
+	cl.get("/login")
+	files, _ := filepath.Glob(filepath.Join(dir, filePrefix+"*"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 session file, got %v", files)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := store.GC(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("expired session file was not removed")
+	}
+
+	// 不合法的id不会用作文件名
+	bad := &client{router: cl.router, cookies: map[string]string{"sid": "../../etc/passwd"}}
+	if body := bad.get("/me"); body != "<nil> []" {
+		t.Errorf("invalid id: got %q", body)
+	}
+}
+
+func TestPanicDoesNotSave(t *testing.T) {
+	store := NewMemoryStore(0)
+	router := see.New()
+	router.Use(see.Recovery(), Sessions("sid", store))
+	router.GET("/panic", func(c *see.Context) {
+		Session(c).Set("half", "written")
+		panic("boom")
+	})
+	router.GET("/half", func(c *see.Context) {
+		c.String(http.StatusOK, "%v", Session(c).Get("half"))
+	})
+	cl := &client{router: router, cookies: map[string]string{}}
+	if body := cl.get("/panic"); body == "" {
+		t.Fatal("expected a response from Recovery")
+	}
+	if len(cl.cookies) != 0 || store.Len() != 0 {
+		t.Errorf("panicked request saved the session: %v", cl.cookies)
+	}
+	if body := cl.get("/half"); body != "<nil>" {
+		t.Errorf("got %q", body)
+	}
+}
+
+func TestDefaultCookieOptions(t *testing.T) {
+	// 只设置MaxAge时Cookie仍然使用默认属性
+	router := newRouter(NewMemoryStore(0), Options{MaxAge: time.Hour})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	cookie := w.Header().Get("Set-Cookie")
+	for _, attr := range []string{"Path=/", "Max-Age=3600", "HttpOnly", "SameSite=Lax"} {
+		if !strings.Contains(cookie, attr) {
+			t.Errorf("expected %s in %q", attr, cookie)
+		}
+	}
+
+	router = newRouter(NewMemoryStore(0), Options{Cookie: &see.CookieOptions{Path: "/app", Secure: true}})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	cookie = w.Header().Get("Set-Cookie")
+	if !strings.Contains(cookie, "Path=/app") || !strings.Contains(cookie, "Secure") || strings.Contains(cookie, "HttpOnly") {
+		t.Errorf("custom cookie options: got %q", cookie)
+	}
+}
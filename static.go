@@ -0,0 +1,263 @@
+package see
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 静态文件的可选配置，见Static和StaticFS
+//
+//	router.Static("/assets", "./dist", see.StaticOptions{
+//		ETag: true,
+//		CacheControl: []see.CacheControlRule{
+//			{Pattern: "*.[0-9a-f]*.js", Value: "public, max-age=31536000, immutable"},
+//			{Pattern: "index.html", Value: "no-cache"},
+//		},
+//		Precompressed: true,
+//	})
+type StaticOptions struct {
+	// 返回强ETag（文件内容的SHA-256），If-None-Match匹配时返回304
+	ETag bool
+	// 按顺序使用第一个匹配文件路径的规则设置Cache-Control
+	CacheControl []CacheControlRule
+	// 客户端支持时返回同目录下预压缩的 .br 或 .gz 文件
+	Precompressed bool
+	// 单页应用模式，不存在且没有扩展名的路径返回该文件（相对于静态目录），
+	// 如 "index.html"。带扩展名的路径如 .js、.css 仍然返回404
+	Fallback string
+	// 不使用Fallback的请求路径前缀，如 "/api"
+	FallbackExclude []string
+}
+
+// Cache-Control规则，Pattern的语法同path.Match。包含 / 时匹配相对于静态目录的路径，
+// 否则只匹配文件名
+type CacheControlRule struct {
+	Pattern string
+	Value   string
+}
+
+// 预压缩文件按顺序选择
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// 按StaticOptions返回文件，条件请求和Range由http.ServeContent处理
+type staticServer struct {
+	fs         http.FileSystem
+	fileServer http.Handler // 没有index.html时列出目录
+	options    StaticOptions
+	etags      sync.Map // 文件路径 -> *etagEntry
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func newStaticServer(fs http.FileSystem, fileServer http.Handler, options StaticOptions) *staticServer {
+	for _, rule := range options.CacheControl {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			panic("invalid cache control pattern '" + rule.Pattern + "'")
+		}
+	}
+	return &staticServer{fs: fs, fileServer: fileServer, options: options}
+}
+
+func (s *staticServer) handle(c *Context) {
+	name := path.Clean(c.Param("filepath"))
+	f, stat, err := openStatic(s.fs, name)
+	if err != nil {
+		if !s.useFallback(c, name) {
+			staticNotFound(c)
+			return
+		}
+		name = path.Join("/", s.options.Fallback)
+		if f, stat, err = openStatic(s.fs, name); err != nil || stat.IsDir() {
+			if err == nil {
+				f.Close()
+			}
+			staticNotFound(c)
+			return
+		}
+	}
+	if stat.IsDir() {
+		f.Close()
+		// 和http.FileServer一样，目录重定向到以 / 结尾的路径
+		if p := c.Req.URL.Path; !strings.HasSuffix(p, "/") {
+			location := path.Base(p) + "/"
+			if q := c.Req.URL.RawQuery; q != "" {
+				location += "?" + q
+			}
+			c.Redirect(http.StatusMovedPermanently, location)
+			return
+		}
+		index := path.Join(name, "index.html")
+		if f, stat, err = openStatic(s.fs, index); err != nil {
+			s.fileServer.ServeHTTP(c.Writer, c.Req)
+			return
+		}
+		name = index
+	}
+	defer f.Close()
+	s.serveFile(c, name, f, stat)
+}
+
+func (s *staticServer) serveFile(c *Context, name string, f http.File, stat fs.FileInfo) {
+	header := c.Writer.Header()
+	if value := s.cacheControl(name); value != "" {
+		header.Set("Cache-Control", value)
+	}
+
+	if s.options.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		accept := c.Req.Header.Get("Accept-Encoding")
+		for _, e := range precompressedEncodings {
+			if !acceptsEncoding(accept, e.encoding) {
+				continue
+			}
+			cf, cstat, err := openStatic(s.fs, name+e.ext)
+			if err != nil || cstat.IsDir() {
+				if err == nil {
+					cf.Close()
+				}
+				continue
+			}
+			defer cf.Close()
+			// Content-Type按原文件确定，避免被识别为压缩格式
+			ctype, err := contentType(name, f)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			header.Set("Content-Type", ctype)
+			header.Set("Content-Encoding", e.encoding)
+			name, f, stat = name+e.ext, cf, cstat
+			break
+		}
+	}
+
+	if s.options.ETag {
+		etag, err := s.etag(name, f, stat)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		header.Set("ETag", etag)
+	}
+
+	http.ServeContent(c.Writer, c.Req, stat.Name(), stat.ModTime(), f)
+}
+
+func (s *staticServer) useFallback(c *Context, name string) bool {
+	if s.options.Fallback == "" || path.Ext(name) != "" {
+		return false
+	}
+	p := c.Req.URL.Path
+	for _, prefix := range s.options.FallbackExclude {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *staticServer) cacheControl(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	for _, rule := range s.options.CacheControl {
+		target := name
+		if !strings.Contains(rule.Pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(rule.Pattern, target); ok {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+// 文件未修改时使用缓存的ETag，否则重新计算内容的哈希
+func (s *staticServer) etag(name string, f http.File, stat fs.FileInfo) (string, error) {
+	if v, ok := s.etags.Load(name); ok {
+		e := v.(*etagEntry)
+		if e.modTime.Equal(stat.ModTime()) && e.size == stat.Size() {
+			return e.etag, nil
+		}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+	s.etags.Store(name, &etagEntry{modTime: stat.ModTime(), size: stat.Size(), etag: etag})
+	return etag, nil
+}
+
+func openStatic(fs http.FileSystem, name string) (http.File, fs.FileInfo, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, stat, nil
+}
+
+// 按扩展名确定Content-Type，未知的扩展名读取文件开头识别
+func contentType(name string, f http.File) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+	var buf [512]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// 客户端是否接受该编码，q=0表示不接受
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params := part, ""
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			name, params = part[:i], part[i+1:]
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return !(strings.HasPrefix(q, "q=0") && strings.Trim(q[len("q=0"):], ".0") == "")
+	}
+	return false
+}
+
+// 文件不存在，和没有匹配到路由一样通过Engine.ErrorRenderer输出
+func staticNotFound(c *Context) {
+	c.RenderError(&HTTPError{
+		Status: http.StatusNotFound,
+		Detail: "file " + c.Path + " not found",
+	})
+}
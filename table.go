@@ -0,0 +1,133 @@
+package see
+
+// 路由表，包含Engine自身和所有Host的路由以及命名路由。
+// 处理请求时原子地读取，预编译之后的修改都在副本上进行，修改完再整体替换
+type routeTable struct {
+	router *route
+	hosts  []*hostRoute
+	names  map[string]*routeEntry
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{router: newRoute(), names: make(map[string]*routeEntry)}
+}
+
+func (t *routeTable) clone() *routeTable {
+	ct := &routeTable{
+		router: t.router.clone(),
+		hosts:  make([]*hostRoute, len(t.hosts)),
+		names:  make(map[string]*routeEntry, len(t.names)),
+	}
+	for i, h := range t.hosts {
+		ch := *h
+		ch.router = h.router.clone()
+		ct.hosts[i] = &ch
+	}
+	for name, entry := range t.names {
+		ct.names[name] = entry
+	}
+	return ct
+}
+
+// Engine自身的路由表和所有Host的路由表
+func (t *routeTable) routers() []*route {
+	routers := []*route{t.router}
+	for _, h := range t.hosts {
+		routers = append(routers, h.router)
+	}
+	return routers
+}
+
+// 返回Host对应的路由表，host为空时返回Engine自身的路由表
+func (t *routeTable) lookup(host string) *route {
+	if host == "" {
+		return t.router
+	}
+	for _, h := range t.hosts {
+		if h.pattern == host {
+			return h.router
+		}
+	}
+	return nil
+}
+
+// 预编译所有路由的中间件链，存到radix树的叶子节点上
+func (t *routeTable) compile(engine *Engine) {
+	handlers := engine.routerGroup.combineHandlers(nil)
+	for _, router := range t.routers() {
+		router.handlers = handlers
+		for _, root := range router.roots {
+			if root == nil {
+				continue
+			}
+			root.walk(func(n *node) {
+				n.handlers = n.route.group.combineHandlers(n.route.middlewares)
+			})
+		}
+	}
+}
+
+// 删除路由，同时删除不再使用的路由名称
+func (t *routeTable) removeRoute(host, method, pattern string) bool {
+	entries := t.lookup(host).removeRoute(method, pattern)
+	if entries == nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.name
+		if name == "" || t.names[name] == nil {
+			continue
+		}
+		delete(t.names, name)
+		// Any注册的其他请求方式仍然可以使用这个名称
+		for _, router := range t.routers() {
+			for _, root := range router.roots {
+				if root == nil {
+					continue
+				}
+				root.walk(func(n *node) {
+					if n.route.name == name {
+						t.names[name] = n.route
+					}
+				})
+			}
+		}
+	}
+	return true
+}
+
+// 修改路由表。预编译之前直接修改；之后可能正在处理请求，
+// 先复制一份路由表，修改并重新预编译后原子地替换，处理中的请求继续使用旧的路由表
+func (this *Engine) modify(fn func(t *routeTable)) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	t := this.table.Load().(*routeTable)
+	if !this.frozen {
+		fn(t)
+		return
+	}
+	t = t.clone()
+	fn(t)
+	t.compile(this)
+	this.table.Store(t)
+}
+
+// 删除路由，pattern与注册时相同，如 /users/:id，返回是否找到该路由。
+// method为Any时删除Any注册的所有请求方式，有一个被删除就返回true。
+// 可以在处理请求的同时调用，正在处理的请求不受影响
+func (this *routerGroup) RemoveRoute(method, pattern string) bool {
+	absolutePath := this.prefix + pattern
+	methods := []string{method}
+	if method == "Any" {
+		methods = anyMethods
+	}
+	removed := false
+	this.engine.modify(func(t *routeTable) {
+		for _, m := range methods {
+			if t.removeRoute(this.host, m, absolutePath) {
+				removed = true
+			}
+		}
+	})
+	return removed
+}
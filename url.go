@@ -0,0 +1,114 @@
+package see
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 注册路由时返回，用于给路由命名
+type Route struct {
+	engine  *Engine
+	entries []*routeEntry // Any注册的每种请求方式各一个
+}
+
+// 给路由命名，之后可以通过Engine.URL或Context.URLFor生成该路由的URL。
+// 同一个名称只能用于同一条路由规则
+//
+// router.GET("/user/:id", handler).Name("user")
+// router.URL("user", "id", "42") // /user/42
+func (this *Route) Name(name string) *Route {
+	if name == "" {
+		panic("route name must not be empty")
+	}
+	// 注册失败的路由没有可以命名的规则
+	if len(this.entries) == 0 {
+		return this
+	}
+	path := this.entries[0].path
+	this.engine.modify(func(t *routeTable) {
+		if entry, ok := t.names[name]; ok && entry.path != path {
+			panic("route name '" + name + "' is already used by path '" + entry.path + "'")
+		}
+		for _, entry := range this.entries {
+			entry.name = name
+		}
+		t.names[name] = this.entries[0]
+	})
+	return this
+}
+
+// 根据路由名称生成URL，params是按参数名、参数值依次排列的键值对，
+// 路由规则中的每个:param和*catchAll都必须提供，没有提供的可选参数连同所在的一级路径一起省略
+//
+// router.GET("/files/:user/*path", handler).Name("file")
+// router.URL("file", "user", "tom", "path", "docs/a b.txt") // /files/tom/docs/a%20b.txt
+func (this *Engine) URL(name string, params ...string) (string, error) {
+	entry, ok := this.table.Load().(*routeTable).names[name]
+	if !ok {
+		return "", fmt.Errorf("route '%s' not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route '%s': params must be key/value pairs", name)
+	}
+	return buildURL(entry.path, params)
+}
+
+// 根据路由名称生成URL，见Engine.URL
+func (c *Context) URLFor(name string, params ...string) (string, error) {
+	return c.engine.URL(name, params...)
+}
+
+// 把路由规则中的参数替换为转义后的参数值
+func buildURL(pattern string, params []string) (string, error) {
+	var b strings.Builder
+	for {
+		wildcard, i, _ := findWildcard(pattern)
+		if i < 0 {
+			b.WriteString(pattern)
+			if b.Len() == 0 {
+				return "/", nil
+			}
+			return b.String(), nil
+		}
+		prefix := pattern[:i]
+		pattern = pattern[i+len(wildcard):]
+
+		optional := wildcard[0] == ':' && strings.HasSuffix(wildcard, "?")
+		key, _, _ := splitWildcard(strings.TrimSuffix(wildcard, "?"))
+		value, ok := lookupParam(params, key)
+		if optional && value == "" {
+			b.WriteString(prefix[:len(prefix)-1])
+			continue
+		}
+		b.WriteString(prefix)
+		if !ok {
+			return "", fmt.Errorf("missing param '%s' for path '%s'", key, b.String()+wildcard+pattern)
+		}
+		if wildcard[0] == ':' {
+			if value == "" {
+				return "", fmt.Errorf("param '%s' must not be empty", key)
+			}
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+
+		// catchAll的值可以包含多级路径，逐段转义，保留 /
+		segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for i, segment := range segments {
+			if i > 0 {
+				b.WriteByte('/')
+			}
+			b.WriteString(url.PathEscape(segment))
+		}
+	}
+}
+
+func lookupParam(params []string, key string) (string, bool) {
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i] == key {
+			return params[i+1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,103 @@
+package see
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// 注册路由失败的原因
+type RouteError struct {
+	Method         string
+	Path           string // 注册的路由规则，通过Engine.Host注册的包含域名
+	Source         string // 注册路由的位置 file:line
+	Existing       string // 与之冲突的已注册路由规则，路由规则本身有误时为空
+	ExistingSource string // 已注册路由的位置
+	Reason         string
+}
+
+func (e *RouteError) Error() string {
+	msg := e.Method + " " + e.Path
+	if e.Source != "" {
+		msg += " (" + e.Source + ")"
+	}
+	msg += ": " + e.Reason
+	if e.Existing != "" {
+		msg += "; existing route " + e.Method + " " + e.Existing
+		if e.ExistingSource != "" {
+			msg += " (" + e.ExistingSource + ")"
+		}
+	}
+	return msg
+}
+
+// 收集到的所有路由冲突
+type RouteErrors []*RouteError
+
+func (e RouteErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d invalid routes:", len(e))
+	for _, err := range e {
+		b.WriteString("\n\t")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// 返回CollectRouteErrors开启时注册失败的所有路由，没有时返回nil。
+// 应在注册完所有路由、启动服务之前调用
+//
+// router.CollectRouteErrors = true
+// router.GET(...)
+// err := router.ValidateRoutes()
+func (this *Engine) ValidateRoutes() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(this.routeErrors) == 0 {
+		return nil
+	}
+	return append(RouteErrors(nil), this.routeErrors...)
+}
+
+// 注册路由失败，默认直接panic，开启CollectRouteErrors时记录下来，跳过该路由继续注册。
+// 调用时持有engine.mu
+func (this *Engine) routeError(host, method string, entry *routeEntry, err error) {
+	e := &RouteError{
+		Method: method,
+		Path:   host + entry.path,
+		Source: entry.source,
+		Reason: err.Error(),
+	}
+	if te, ok := err.(*treeError); ok && te.existing != nil {
+		e.Existing = host + te.existing.fullPath
+		if existing := te.existing.route; existing != nil {
+			e.ExistingSource = existing.source
+		}
+	}
+	if !this.CollectRouteErrors {
+		panic(e)
+	}
+	this.routeErrors = append(this.routeErrors, e)
+}
+
+var packagePath = reflect.TypeOf((*Engine)(nil)).Elem().PkgPath()
+
+// 返回注册路由的位置，跳过本包内部的调用
+func callerSource() string {
+	pc := make([]uintptr, 16)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, packagePath+".") &&
+			!strings.HasSuffix(frame.File, "_test.go")
+		if !internal {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package see
+
+import (
+	"net/http"
+	"strings"
+)
+
+// 返回只匹配指定API版本的分组，前缀与当前分组相同，中间件继承当前分组。
+// 同一路由可以按版本分别注册，请求的版本依次从VersionHeader头、
+// Accept头中的 application/vnd.xxx.v2+json 获取，都没有时使用DefaultVersion。
+// 没有指定版本的路由匹配所有版本，没有匹配的版本时返回406
+//
+// v1 := api.Version("1")
+// v1.GET("/users", listUsersV1)
+// v2 := api.Version("2")
+// v2.GET("/users", listUsersV2)
+func (this *routerGroup) Version(version string) *routerGroup {
+	group := this.Group("")
+	group.version = normalizeVersion(version)
+	if group.version == "" {
+		panic("api version must not be empty")
+	}
+	return group
+}
+
+// v2 和 2 是同一个版本
+func normalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if len(version) > 1 && (version[0] == 'v' || version[0] == 'V') {
+		version = version[1:]
+	}
+	return version
+}
+
+// 请求的API版本
+func requestVersion(c *Context) string {
+	engine := c.engine
+	if engine.VersionHeader != "" {
+		if version := c.Req.Header.Get(engine.VersionHeader); version != "" {
+			return normalizeVersion(version)
+		}
+	}
+	if version := acceptVersion(c.Req.Header.Get("Accept")); version != "" {
+		return version
+	}
+	return normalizeVersion(engine.DefaultVersion)
+}
+
+// 从Accept头中获取版本，支持 application/vnd.acme.v2+json 和
+// application/vnd.acme+json; version=2 两种写法
+func acceptVersion(accept string) string {
+	for accept != "" {
+		var mediaType string
+		if i := strings.IndexByte(accept, ','); i >= 0 {
+			mediaType, accept = accept[:i], accept[i+1:]
+		} else {
+			mediaType, accept = accept, ""
+		}
+
+		params := ""
+		if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+			mediaType, params = mediaType[:i], mediaType[i+1:]
+		}
+		i := strings.IndexByte(mediaType, '/')
+		if i < 0 {
+			continue
+		}
+		subtype := strings.TrimSpace(mediaType[i+1:])
+		if !strings.HasPrefix(subtype, "vnd.") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "version=") {
+				return normalizeVersion(strings.Trim(param[len("version="):], `"`))
+			}
+		}
+		if i := strings.IndexByte(subtype, '+'); i >= 0 {
+			subtype = subtype[:i]
+		}
+		if version := subtypeVersion(subtype); version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+// 子类型末尾的 v2、v2.1 为版本号，vnd.vimeo 之类以v开头的厂商名不是版本
+func subtypeVersion(subtype string) string {
+	parts := strings.Split(subtype, ".")
+	// 从后往前跳过纯数字的部分，如 v2.1 中的 1
+	i := len(parts) - 1
+	for i > 0 && isDigits(parts[i]) {
+		i--
+	}
+	// parts[0]是vnd
+	if i == 0 {
+		return ""
+	}
+	part := parts[i]
+	if len(part) < 2 || (part[0] != 'v' && part[0] != 'V') || !isDigits(part[1:]) {
+		return ""
+	}
+	return strings.Join(append([]string{part[1:]}, parts[i+1:]...), ".")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 按请求的API版本选择处理函数，版本相同的优先，其次是没有指定版本的路由，
+// 都没有时返回nil
+func selectVersion(c *Context, leaf *node) *node {
+	header := c.Writer.Header()
+	header.Add("Vary", "Accept")
+	if c.engine.VersionHeader != "" {
+		header.Add("Vary", c.engine.VersionHeader)
+	}
+
+	version := requestVersion(c)
+	if n := leaf.variant(version); n != nil {
+		return n
+	}
+	return leaf.variant("")
+}
+
+func notAcceptable(c *Context) {
+	c.RenderError(&HTTPError{
+		Status: http.StatusNotAcceptable,
+		Detail: "no version of " + c.Method + " " + c.Path + " matches the request",
+	})
+}